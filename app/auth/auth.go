@@ -0,0 +1,253 @@
+// Package auth authenticates and authorizes requests to the http API using API keys and
+// address allow-lists.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/tlsconfig"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Scope is a permission granted to an API key.
+type Scope string
+
+const (
+	ReadScope   Scope = "read"
+	IndexScope  Scope = "index"
+	DeleteScope Scope = "delete"
+)
+
+// ApiKeyHeader is the http header that can be used instead of a bearer token to send an API key.
+const ApiKeyHeader = "X-API-Key"
+
+type apiKey struct {
+	name   string
+	hash   [sha256.Size]byte
+	scopes map[Scope]bool
+	tenant string
+}
+
+// Authenticator verifies the client address and credentials of requests.
+type Authenticator struct {
+	allowed []*net.IPNet
+	proxies []*net.IPNet
+	keys    []apiKey
+	// requireCert is set when client certificates are optional in the TLS handshake but required
+	// for protected routes.
+	requireCert bool
+	logger      *logging.Logger
+}
+
+// New creates an authenticator for the allow-list, trusted proxies, and API keys in the configuration.
+// The keys must already be read from their key files.
+func New(config model.Configuration, logger *logging.Logger) (*Authenticator, error) {
+	allowed, err := parseNetworks(config.IpWhitelist)
+	if err != nil {
+		return nil, errors.New("invalid ip_whitelist: " + err.Error())
+	}
+	proxies, err := parseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, errors.New("invalid trusted_proxies: " + err.Error())
+	}
+	clientAuth, err := tlsconfig.ClientAuth(config)
+	if err != nil {
+		return nil, err
+	}
+	a := &Authenticator{allowed: allowed, proxies: proxies, requireCert: clientAuth == tlsconfig.ClientAuthOptional,
+		logger: logger}
+	for _, key := range config.ApiKeys {
+		if len(key.Key) == 0 {
+			return nil, fmt.Errorf("api key %q has no key", key.Name)
+		}
+		scopes := make(map[Scope]bool)
+		for _, scope := range key.Scopes {
+			switch Scope(scope) {
+			case ReadScope, IndexScope, DeleteScope:
+				scopes[Scope(scope)] = true
+			default:
+				return nil, fmt.Errorf("api key %q has unknown scope %q", key.Name, scope)
+			}
+		}
+		a.keys = append(a.keys, apiKey{name: key.Name, hash: sha256.Sum256([]byte(key.Key)), scopes: scopes,
+			tenant: key.Tenant})
+	}
+	return a, nil
+}
+
+// Require wraps the handler to allow requests from allowed client addresses and, when API keys are
+// configured, with a key that has the scope.
+func (a *Authenticator) Require(scope Scope, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), a.logger)
+		name, err := a.Authorize(request, scope)
+		if err != nil {
+			a.refuse(response, err, logger)
+			return
+		}
+		if len(name) > 0 {
+			logger = logger.With(logging.F("api_key", name))
+			request = request.WithContext(logging.NewContext(request.Context(), logger))
+		}
+		next.ServeHTTP(response, request)
+	})
+}
+
+// Authorize verifies the request for the scope and returns the name of the API key used, if any.
+func (a *Authenticator) Authorize(request *http.Request, scope Scope) (string, error) {
+	client := a.ClientIp(request)
+	if !a.allowedIp(client) {
+		return "", Forbidden{CAUSE: fmt.Sprintf("remote address %s is not allowed", client)}
+	}
+	if a.requireCert && (request.TLS == nil || len(request.TLS.VerifiedChains) == 0) {
+		return "", Unauthorized{CAUSE: "missing client certificate"}
+	}
+	if len(a.keys) == 0 {
+		return "", nil
+	}
+	credential := requestKey(request)
+	if len(credential) == 0 {
+		return "", Unauthorized{CAUSE: "missing API key"}
+	}
+	key, ok := a.findKey(credential)
+	if !ok {
+		return "", Unauthorized{CAUSE: "invalid API key"}
+	}
+	if !key.scopes[scope] {
+		return key.name, Forbidden{CAUSE: fmt.Sprintf("API key %s does not have the %s scope", key.name, scope)}
+	}
+	return key.name, nil
+}
+
+// ClientIp returns the address of the client. When the request comes from a trusted proxy, the client
+// is the last address in the X-Forwarded-For header that is not a trusted proxy.
+func (a *Authenticator) ClientIp(request *http.Request) net.IP {
+	ip := remoteIp(request)
+	if ip == nil || !contains(a.proxies, ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if address == nil {
+			break
+		}
+		ip = address
+		if !contains(a.proxies, ip) {
+			break
+		}
+	}
+	return ip
+}
+
+// ForwardedProto wraps the handler to remove the X-Forwarded-Proto header from requests that do not
+// come from a trusted proxy, so that clients cannot set the scheme of the urls in responses.
+func (a *Authenticator) ForwardedProto(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if len(request.Header.Values(forwardedProtoHeader)) > 0 {
+			if ip := remoteIp(request); ip == nil || !contains(a.proxies, ip) {
+				request = request.Clone(request.Context())
+				request.Header.Del(forwardedProtoHeader)
+			}
+		}
+		next.ServeHTTP(response, request)
+	})
+}
+
+// forwardedProtoHeader is the header in which proxies send the scheme of the client request.
+const forwardedProtoHeader = "X-Forwarded-Proto"
+
+// remoteIp returns the address the request was received from, or nil if it is not an IP address.
+func remoteIp(request *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		host = request.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+func (a *Authenticator) allowedIp(ip net.IP) bool {
+	if len(a.allowed) == 0 {
+		return true
+	}
+	return ip != nil && contains(a.allowed, ip)
+}
+
+func (a *Authenticator) findKey(credential string) (apiKey, bool) {
+	hash := sha256.Sum256([]byte(credential))
+	for _, key := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], key.hash[:]) == 1 {
+			return key, true
+		}
+	}
+	return apiKey{}, false
+}
+
+func (a *Authenticator) refuse(response http.ResponseWriter, err error, logger *logging.Logger) {
+	logger.Warn("Request refused.", logging.Err(err))
+	status := http.StatusForbidden
+	body := model.StatusResponse{Status: "error", Error: &model.ErrorResponse{Code: "forbidden", Message: err.Error()}}
+	if _, ok := err.(Unauthorized); ok {
+		status = http.StatusUnauthorized
+		body.Error.Code = "unauthorized"
+		response.Header().Set("WWW-Authenticate", "Bearer")
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	if err := json.NewEncoder(response).Encode(body); err != nil {
+		logger.Error("Unable to write response.", logging.Err(err))
+	}
+}
+
+// requestKey returns the API key from the bearer token or the X-API-Key header.
+func requestKey(request *http.Request) string {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) > 7 && strings.EqualFold(authorization[0:7], "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return request.Header.Get(ApiKeyHeader)
+}
+
+// parseNetworks parses IP addresses and CIDR ranges.
+func parseNetworks(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func contains(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
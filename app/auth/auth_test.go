@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	authenticator, err := New(model.Configuration{
+		IpWhitelist: []string{"10.0.0.0/8", "192.168.1.5"},
+		ApiKeys: []model.ApiKey{
+			{Name: "reader", Key: "read-key", Scopes: []string{"read"}},
+			{Name: "indexer", Key: "index-key", Scopes: []string{"read", "index"}},
+		},
+	}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	noop := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handlers := map[string]http.Handler{
+		http.MethodGet:  authenticator.Require(ReadScope, noop),
+		http.MethodPost: authenticator.Require(IndexScope, noop),
+	}
+
+	tests := []struct {
+		method string
+		remote string
+		key    string
+		status int
+	}{
+		{http.MethodGet, "10.1.2.3:1234", "read-key", http.StatusOK},
+		{http.MethodGet, "192.168.1.5:1234", "read-key", http.StatusOK},
+		{http.MethodGet, "192.168.1.6:1234", "read-key", http.StatusForbidden},
+		{http.MethodGet, "10.1.2.3:1234", "", http.StatusUnauthorized},
+		{http.MethodGet, "10.1.2.3:1234", "wrong", http.StatusUnauthorized},
+		{http.MethodPost, "10.1.2.3:1234", "read-key", http.StatusForbidden},
+		{http.MethodPost, "10.1.2.3:1234", "index-key", http.StatusOK},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, "/item/1234", nil)
+		request.RemoteAddr = test.remote
+		if len(test.key) > 0 {
+			request.Header.Set("Authorization", "Bearer "+test.key)
+		}
+		response := httptest.NewRecorder()
+		handlers[test.method].ServeHTTP(response, request)
+		if response.Code != test.status {
+			t.Errorf("%s from %s with key %q: expected %d, got %d", test.method, test.remote, test.key,
+				test.status, response.Code)
+		}
+	}
+}
+
+func TestClientIp(t *testing.T) {
+	authenticator, err := New(model.Configuration{TrustedProxies: []string{"172.16.0.0/12"}}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/item/1234", nil)
+	request.RemoteAddr = "172.16.0.2:1234"
+	request.Header.Set("X-Forwarded-For", "1.2.3.4, 5.6.7.8, 172.16.0.3")
+	if ip := authenticator.ClientIp(request); ip.String() != "5.6.7.8" {
+		t.Errorf("expected last untrusted forwarded address, got %s", ip)
+	}
+	request.RemoteAddr = "5.6.7.9:1234"
+	if ip := authenticator.ClientIp(request); ip.String() != "5.6.7.9" {
+		t.Errorf("expected forwarded header from untrusted address to be ignored, got %s", ip)
+	}
+}
+
+func TestForwardedProto(t *testing.T) {
+	authenticator, err := New(model.Configuration{TrustedProxies: []string{"172.16.0.0/12"}}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var proto string
+	handler := authenticator.ForwardedProto(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto = r.Header.Get("X-Forwarded-Proto")
+	}))
+	request := httptest.NewRequest(http.MethodGet, "/search/1234", nil)
+	request.Header.Set("X-Forwarded-Proto", "https")
+	request.RemoteAddr = "172.16.0.2:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if proto != "https" {
+		t.Errorf("expected the header of a trusted proxy to be kept, got %q", proto)
+	}
+	request.RemoteAddr = "5.6.7.9:1234"
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	if proto != "" {
+		t.Errorf("expected the header of an untrusted client to be removed, got %q", proto)
+	}
+}
+
+func TestNewRejectsInvalidConfiguration(t *testing.T) {
+	if _, err := New(model.Configuration{IpWhitelist: []string{"10.0.0.0/33"}}, logging.Discard()); err == nil {
+		t.Errorf("expected error for invalid CIDR range")
+	}
+	keys := []model.ApiKey{{Name: "admin", Key: "key", Scopes: []string{"admin"}}}
+	if _, err := New(model.Configuration{ApiKeys: keys}, logging.Discard()); err == nil {
+		t.Errorf("expected error for unknown scope")
+	}
+}
+
+func TestTenants(t *testing.T) {
+	authenticator, err := New(model.Configuration{
+		ApiKeys: []model.ApiKey{
+			{Name: "admin", Key: "admin-key", Scopes: []string{"read"}},
+			{Name: "library", Key: "library-key", Scopes: []string{"read"}, Tenant: "library"},
+		},
+	}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var path string
+	handler := authenticator.Tenants([]string{"/item/", "/health/ready"},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { path = r.URL.Path }))
+
+	tests := []struct {
+		path   string
+		key    string
+		status int
+		routed string
+	}{
+		{"/item/1234", "admin-key", http.StatusOK, "/item/1234"},
+		{"/t/archive/item/1234", "admin-key", http.StatusOK, "/t/archive/item/1234"},
+		{"/item/1234", "library-key", http.StatusOK, "/t/library/item/1234"},
+		{"/health/ready", "library-key", http.StatusOK, "/t/library/health/ready"},
+		{"/metrics", "library-key", http.StatusOK, "/metrics"},
+		{"/t/library/item/1234", "library-key", http.StatusOK, "/t/library/item/1234"},
+		{"/t/archive/item/1234", "library-key", http.StatusForbidden, ""},
+		{"/item/1234", "", http.StatusOK, "/item/1234"},
+	}
+	for _, test := range tests {
+		path = ""
+		request := httptest.NewRequest(http.MethodGet, test.path, nil)
+		if len(test.key) > 0 {
+			request.Header.Set(ApiKeyHeader, test.key)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != test.status || path != test.routed {
+			t.Errorf("%s with key %q: expected %d routed to %q, got %d routed to %q", test.path, test.key,
+				test.status, test.routed, response.Code, path)
+		}
+	}
+}
+
+func TestRequireGlobal(t *testing.T) {
+	authenticator, err := New(model.Configuration{
+		ApiKeys: []model.ApiKey{
+			{Name: "admin", Key: "admin-key", Scopes: []string{"read"}},
+			{Name: "library", Key: "library-key", Scopes: []string{"read"}, Tenant: "library"},
+		},
+	}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := authenticator.RequireGlobal(ReadScope, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for key, status := range map[string]int{"admin-key": http.StatusOK, "library-key": http.StatusForbidden,
+		"": http.StatusUnauthorized} {
+		request := httptest.NewRequest(http.MethodGet, "/config", nil)
+		if len(key) > 0 {
+			request.Header.Set(ApiKeyHeader, key)
+		}
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, request)
+		if response.Code != status {
+			t.Errorf("key %q: expected %d, got %d", key, status, response.Code)
+		}
+	}
+}
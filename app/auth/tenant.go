@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"fmt"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"net/http"
+	"strings"
+)
+
+// TenantPrefix is the path prefix of tenant routes, followed by the tenant name.
+const TenantPrefix = "/t/"
+
+// KeyTenant returns the tenant of the API key sent with the request, or an empty string if the request
+// has no valid key or the key is not restricted to a tenant.
+func (a *Authenticator) KeyTenant(request *http.Request) string {
+	credential := requestKey(request)
+	if len(credential) == 0 {
+		return ""
+	}
+	key, _ := a.findKey(credential)
+	return key.tenant
+}
+
+// Tenants wraps the handler to select the tenant of requests by their API key. Requests to a tenant
+// route with a key of another tenant are refused. Requests to one of the paths that tenants serve
+// without the tenant prefix, with a key that is restricted to a tenant, are handled by the tenant's route.
+func (a *Authenticator) Tenants(paths []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		tenant := a.KeyTenant(request)
+		if len(tenant) == 0 {
+			next.ServeHTTP(response, request)
+			return
+		}
+		if strings.HasPrefix(request.URL.Path, TenantPrefix) {
+			name := strings.SplitN(strings.TrimPrefix(request.URL.Path, TenantPrefix), "/", 2)[0]
+			if name != tenant {
+				logger := logging.FromContext(request.Context(), a.logger)
+				a.refuse(response, Forbidden{CAUSE: fmt.Sprintf("API key is not valid for tenant %s", name)}, logger)
+				return
+			}
+		} else if servedPath(paths, request.URL.Path) {
+			tenantRequest := request.Clone(request.Context())
+			tenantRequest.URL.Path = TenantPrefix + tenant + request.URL.Path
+			tenantRequest.URL.RawPath = ""
+			request = tenantRequest
+		}
+		next.ServeHTTP(response, request)
+	})
+}
+
+// RequireGlobal wraps the handler like Require and also refuses API keys that are restricted to a
+// tenant, for routes that are shared by all tenants such as the configuration and metrics.
+func (a *Authenticator) RequireGlobal(scope Scope, next http.Handler) http.Handler {
+	return a.Require(scope, http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if tenant := a.KeyTenant(request); len(tenant) > 0 {
+			logger := logging.FromContext(request.Context(), a.logger)
+			a.refuse(response, Forbidden{CAUSE: fmt.Sprintf("API key of tenant %s is not valid for %s", tenant,
+				request.URL.Path)}, logger)
+			return
+		}
+		next.ServeHTTP(response, request)
+	}))
+}
+
+// servedPath reports whether the path is one of the paths, or below a path that ends with a slash.
+func servedPath(paths []string, path string) bool {
+	for _, served := range paths {
+		if path == served || (strings.HasSuffix(served, "/") && strings.HasPrefix(path, served)) {
+			return true
+		}
+	}
+	return false
+}
@@ -33,3 +33,19 @@ func (e UnProcessableEntity) Error() string {
 func (e NotFound) Error() string {
 	return fmt.Sprintf("Item is not in Solr index: %v", e.ID)
 }
+
+type Unauthorized struct {
+	CAUSE string
+}
+
+type Forbidden struct {
+	CAUSE string
+}
+
+func (e Unauthorized) Error() string {
+	return fmt.Sprintf("Authentication required: %v", e.CAUSE)
+}
+
+func (e Forbidden) Error() string {
+	return fmt.Sprintf("Access denied: %v", e.CAUSE)
+}
@@ -4,6 +4,7 @@ go 1.16
 
 require (
 	github.com/beevik/etree v1.1.0
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/spf13/viper v1.7.1
 	golang.org/x/net v0.0.0-20220403103023-749bd193bc2b // indirect
 )
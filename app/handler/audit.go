@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// orphanFileAge is the minimum age of files reported as orphans, so that files written for items
+// being indexed, whose documents are not yet committed, are not reported.
+const orphanFileAge = time.Hour
+
+// AuditOptions select the checks and repairs made by Audit.
+type AuditOptions struct {
+	// DSpace compares the index with the DSpace items that have IIIF search enabled.
+	DSpace bool
+	// Fix repairs the inconsistencies found.
+	Fix bool
+}
+
+// auditItem is the indexed state of an item collected by an audit.
+type auditItem struct {
+	uuid  string
+	valid bool
+	pages []process.PageState
+	// missing is set if a lazy document's file does not exist.
+	missing bool
+}
+
+// Audit compares the Solr index with the OCR file directory and, optionally, with DSpace. It reports
+// documents of items that are not in DSpace with IIIF search enabled, lazy documents whose file is missing,
+// files that no document refers to, and DSpace items that are not indexed. Only documents of the configured
+// manifest base, and files in the configured layout of items found in the index or in DSpace, are audited,
+// so that other repositories sharing the index or directory are not affected. With the Fix option, orphan
+// documents and files are deleted, and items with missing files or no documents are indexed. Documents
+// whose manifest url is not an item manifest are reported but not deleted.
+func Audit(ctx context.Context, settings *model.Configuration, options AuditOptions,
+	log *logging.Logger) (model.AuditReport, error) {
+	report := model.AuditReport{OrphanDocuments: []model.AuditItem{}, MissingFiles: []model.AuditFile{},
+		OrphanFiles: []string{}, UnindexedItems: []string{}}
+	started := time.Now()
+	var enabled map[string]bool
+	if options.DSpace {
+		uuids, err := process.SearchEnabledItems(*settings, log)
+		if err != nil {
+			return report, err
+		}
+		enabled = make(map[string]bool, len(uuids))
+		for _, uuid := range uuids {
+			enabled[uuid] = true
+		}
+		count := len(enabled)
+		report.DSpaceItems = &count
+	}
+
+	// files are listed before the documents are scanned, so that files of documents indexed during the
+	// scan are not reported as orphans. Files are mapped to their modification time.
+	files := make(map[string]time.Time)
+	if len(settings.XmlFileLocation) > 0 {
+		fileItem, err := process.FileItemMatcher(*settings)
+		if err != nil {
+			return report, err
+		}
+		err = process.ListFiles(*settings, func(path string, modified time.Time) error {
+			// only files in the layout belong to this repository
+			if _, ok := fileItem(path); ok {
+				files[filepath.Clean(path)] = modified
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+	report.Files = len(files)
+
+	items := make(map[string]*auditItem)
+	referenced := make(map[string]bool)
+	err := process.ScanDocuments(*settings, func(doc process.IndexedDocument) error {
+		report.Documents++
+		item, ok := items[doc.ManifestUrl]
+		if !ok {
+			item = &auditItem{}
+			item.uuid, item.valid = process.ManifestItem(*settings, doc.ManifestUrl)
+			items[doc.ManifestUrl] = item
+		}
+		item.pages = append(item.pages, process.PageState{SolrId: doc.SolrId, FilePath: doc.FilePath})
+		if len(doc.FilePath) > 0 {
+			path := filepath.Clean(doc.FilePath)
+			referenced[path] = true
+			if _, listed := files[path]; listed {
+				return nil
+			}
+			// the file may have been written after the files were listed
+			if exists, err := process.FileExists(*settings, path); err == nil && !exists {
+				item.missing = true
+				report.MissingFiles = append(report.MissingFiles, model.AuditFile{SolrId: doc.SolrId,
+					FilePath: doc.FilePath})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	report.Items = len(items)
+
+	orphans := make(map[string]bool)
+	indexed := make(map[string]bool)
+	for manifestUrl, item := range items {
+		indexed[item.uuid] = true
+		if !item.valid || (enabled != nil && !enabled[item.uuid]) {
+			if item.valid {
+				orphans[manifestUrl] = true
+			}
+			report.OrphanDocuments = append(report.OrphanDocuments, model.AuditItem{Id: item.uuid,
+				ManifestUrl: manifestUrl, Documents: len(item.pages)})
+		}
+	}
+	sort.Slice(report.OrphanDocuments, func(i, j int) bool {
+		return report.OrphanDocuments[i].ManifestUrl < report.OrphanDocuments[j].ManifestUrl
+	})
+	for uuid := range enabled {
+		if !indexed[uuid] {
+			report.UnindexedItems = append(report.UnindexedItems, uuid)
+		}
+	}
+	sort.Strings(report.UnindexedItems)
+
+	// files of deleted Items and of Items without documents are orphans as well
+	for path, modified := range files {
+		if !referenced[path] && started.Sub(modified) >= orphanFileAge {
+			report.OrphanFiles = append(report.OrphanFiles, path)
+		}
+	}
+	sort.Strings(report.OrphanFiles)
+	log.Info("Audit completed.", logging.F("documents", report.Documents), logging.F("items", report.Items),
+		logging.F("orphan_items", len(report.OrphanDocuments)), logging.F("missing_files", len(report.MissingFiles)),
+		logging.F("orphan_files", len(report.OrphanFiles)), logging.F("unindexed_items", len(report.UnindexedItems)),
+		logging.Duration(started))
+	if options.Fix && !report.Consistent() {
+		report.Repairs = repair(ctx, settings, report, items, orphans, log)
+	}
+	return report, nil
+}
+
+// repair deletes orphan documents and files, and indexes items with missing files or no documents.
+func repair(ctx context.Context, settings *model.Configuration, report model.AuditReport,
+	items map[string]*auditItem, orphans map[string]bool, log *logging.Logger) *model.AuditRepairs {
+	repairs := &model.AuditRepairs{}
+	failed := func(err error) {
+		log.Warn("Audit repair failed.", logging.Err(err))
+		repairs.Errors = append(repairs.Errors, err.Error())
+	}
+	for manifestUrl := range orphans {
+		item := items[manifestUrl]
+		if err := process.DeletePages(*settings, item.uuid, item.pages); err != nil {
+			failed(err)
+			continue
+		}
+		repairs.DocumentsDeleted += len(item.pages)
+	}
+
+	reindex := append([]string{}, report.UnindexedItems...)
+	for manifestUrl, item := range items {
+		if item.valid && item.missing && !orphans[manifestUrl] {
+			reindex = append(reindex, item.uuid)
+		}
+	}
+	for _, uuid := range reindex {
+		if ctx.Err() != nil {
+			failed(ctx.Err())
+			break
+		}
+		uuid := uuid
+		_, err := HandleAction(ctx, AddItem{}, settings, &uuid, log.With(logging.F("audit", true)))
+		recordItemMetrics(IndexAction, err)
+		if err != nil {
+			failed(err)
+			continue
+		}
+		repairs.ItemsIndexed++
+	}
+
+	for _, path := range report.OrphanFiles {
+		if err := process.RemoveFile(*settings, path); err != nil {
+			failed(err)
+			continue
+		}
+		repairs.FilesRemoved++
+	}
+	if err := process.CommitSolr(*settings); err != nil {
+		failed(err)
+	}
+	return repairs
+}
+
+// AuditHandler returns the http handler that runs an audit and writes the report as JSON. The dspace
+// query parameter adds the comparison with DSpace. Repairs are made if fix is true, and run under the server
+// context so that a client disconnect does not interrupt the Items being indexed.
+func AuditHandler(config *model.Configuration, logger *logging.Logger, fix bool) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+		options := AuditOptions{Fix: fix}
+		if value := request.URL.Query().Get("dspace"); len(value) > 0 {
+			dspace, err := strconv.ParseBool(value)
+			if err != nil {
+				writeStatus(response, http.StatusBadRequest, "bad_request", "invalid dspace parameter: "+value, logger)
+				return
+			}
+			options.DSpace = dspace
+		}
+		report, err := Audit(serverContext(request), config, options, logger)
+		if err != nil {
+			writeError(response, err, logger)
+			return
+		}
+		writeJson(response, report, logger)
+	})
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte("<ocr/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modified := time.Now().Add(-age)
+		if err := os.Chtimes(path, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	const (
+		a = "aaaaaaaa-0000-0000-0000-000000000000"
+		b = "bbbbbbbb-0000-0000-0000-000000000000"
+		c = "cccccccc-0000-0000-0000-000000000000"
+	)
+	existing := write(a+"-page1.xml", 2*time.Hour)
+	orphan := write(b+"-page1.xml", 2*time.Hour)
+	write(c+"-page2.xml", time.Minute)
+	// a file of a deleted item that is neither indexed nor in DSpace
+	deleted := write("dddddddd-0000-0000-0000-000000000000-page1.xml", 2*time.Hour)
+	// files that do not match the layout are ignored
+	write("notes.txt", 2*time.Hour)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/discover/search/objects" {
+			items := []string{}
+			for _, uuid := range []string{a, c} {
+				items = append(items, fmt.Sprintf(`{"_embedded":{"indexableObject":{"uuid":"%s","inArchive":true,
+"metadata":{"dspace.iiif.enabled":[{"value":"true"}],"iiif.search.enabled":[{"value":"true"}]}}}}`, uuid))
+			}
+			_, _ = fmt.Fprintf(w, `{"_embedded":{"searchResult":{"_embedded":{"objects":[%s]},
+"page":{"number":0,"totalPages":1}}}}`, strings.Join(items, ","))
+			return
+		}
+		if fq := r.URL.Query().Get("fq"); fq != "{!prefix f=manifest_url}"+server.URL+"/iiif/" {
+			t.Errorf("expected documents of the manifest base, got filter %q", fq)
+		}
+		docs := []string{
+			fmt.Sprintf(`{"id":"a-page1","manifest_url":"%s/iiif/%s/manifest","ocr_text":"%s{ascii}"}`, server.URL, a,
+				existing),
+			fmt.Sprintf(`{"id":"a-page2","manifest_url":"%s/iiif/%s/manifest","ocr_text":"%s"}`, server.URL, a,
+				filepath.Join(dir, a+"-page2.xml")),
+			fmt.Sprintf(`{"id":"b-page1","manifest_url":"%s/iiif/%s/manifest","ocr_text":"<ocr/>"}`, server.URL, b),
+			fmt.Sprintf(`{"id":"z-page1","manifest_url":"%s/iiif/z/other","ocr_text":"<ocr/>"}`, server.URL),
+		}
+		// return two documents per cursor page
+		cursor := r.URL.Query().Get("cursorMark")
+		start := 0
+		if cursor != "*" {
+			_, _ = fmt.Sscanf(cursor, "%d", &start)
+		}
+		end := start + 2
+		if end > len(docs) {
+			end = len(docs)
+		}
+		_, _ = fmt.Fprintf(w, `{"response":{"numFound":%d,"docs":[%s]},"nextCursorMark":"%d"}`, len(docs),
+			strings.Join(docs[start:end], ","), end)
+	}))
+	defer server.Close()
+
+	config := &model.Configuration{DSpaceHost: server.URL, ManifestBase: server.URL, SolrUrl: server.URL,
+		SolrCore: "core", XmlFileLocation: dir}
+	report, err := Audit(context.Background(), config, AuditOptions{DSpace: true}, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Documents != 4 || report.Items != 3 || report.Files != 4 || *report.DSpaceItems != 2 {
+		t.Errorf("unexpected counts: %+v", report)
+	}
+	if len(report.OrphanDocuments) != 2 || report.OrphanDocuments[0].Id != b || report.OrphanDocuments[1].Id != "" {
+		t.Errorf("unexpected orphan documents: %+v", report.OrphanDocuments)
+	}
+	if len(report.MissingFiles) != 1 || report.MissingFiles[0].SolrId != "a-page2" {
+		t.Errorf("unexpected missing files: %+v", report.MissingFiles)
+	}
+	if len(report.OrphanFiles) != 2 || report.OrphanFiles[0] != orphan || report.OrphanFiles[1] != deleted {
+		t.Errorf("expected the old unreferenced files to be orphans, got %v", report.OrphanFiles)
+	}
+	if len(report.UnindexedItems) != 1 || report.UnindexedItems[0] != c {
+		t.Errorf("unexpected unindexed items: %v", report.UnindexedItems)
+	}
+	if report.Consistent() || report.Repairs != nil {
+		t.Errorf("expected an inconsistent report without repairs")
+	}
+}
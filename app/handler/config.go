@@ -0,0 +1,14 @@
+package handler
+
+import (
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+)
+
+// ConfigHandler returns the http handler that writes the configuration as JSON, with credentials redacted.
+func ConfigHandler(config *model.Configuration, logger *logging.Logger) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		writeJson(response, config.Redacted(), logging.FromContext(request.Context(), logger))
+	})
+}
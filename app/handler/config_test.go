@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConfigHandler(t *testing.T) {
+	password := "tenant-secret"
+	config := &model.Configuration{
+		DSpaceHost:     "http://localhost:8080/server",
+		DSpacePassword: "dspace-secret",
+		SolrToken:      "solr-secret",
+		ApiKeys:        []model.ApiKey{{Name: "reader", Key: "key-secret", Scopes: []string{"read"}}},
+		Tenants:        []model.Tenant{{Name: "library", DSpacePassword: &password}},
+	}
+	response := httptest.NewRecorder()
+	ConfigHandler(config, logging.Discard()).ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/config", nil))
+	body := response.Body.String()
+	if response.Code != http.StatusOK || !strings.Contains(body, "http://localhost:8080/server") {
+		t.Fatalf("expected configuration, got %d: %s", response.Code, body)
+	}
+	if strings.Contains(body, "secret") {
+		t.Errorf("expected credentials to be redacted: %s", body)
+	}
+	if config.ApiKeys[0].Key != "key-secret" || *config.Tenants[0].DSpacePassword != "tenant-secret" {
+		t.Errorf("expected configuration to be unchanged")
+	}
+}
@@ -1,14 +1,35 @@
 package handler
 
 import (
+	"context"
+	"github.com/mspalti/ocrprocessor/logging"
 	"github.com/mspalti/ocrprocessor/model"
-	"log"
+	"net/http"
 )
 
-func HandleAction(indexer Indexer, settings *model.Configuration, uuid *string, logger *log.Logger) error {
-	err := indexer.IndexerAction(settings, uuid, logger)
+type serverContextKey struct{}
+
+// WithServerContext marks the server base context, which is cancelled only when the server shuts down,
+// so that item actions can run under it instead of the request context.
+func WithServerContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, serverContextKey{}, ctx)
+}
+
+// serverContext returns the server base context of the request. Unlike the request context, it is not
+// cancelled when the client disconnects, which would interrupt indexing and roll back the item. Requests
+// that are not served by a marked server run under a context that is never cancelled.
+func serverContext(request *http.Request) context.Context {
+	if ctx, ok := request.Context().Value(serverContextKey{}).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+func HandleAction(ctx context.Context, indexer Indexer, settings *model.Configuration, uuid *string,
+	logger *logging.Logger) (model.ItemResult, error) {
+	result, err := indexer.IndexerAction(ctx, settings, uuid, logger)
 	if err != nil {
-		return err
+		return result, err
 	}
-	return nil
+	return result, nil
 }
@@ -1,39 +1,42 @@
 package handler
 
 import (
+	"context"
+	"github.com/mspalti/ocrprocessor/logging"
 	"github.com/mspalti/ocrprocessor/model"
-	"log"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 type SpyFakeAddItem struct {
 	settings               *model.Configuration
 	uuid                   *string
-	log                    *log.Logger
+	log                    *logging.Logger
 	indexerActionWasCalled bool
 }
 
 type SpyFakeDeleteItem struct {
 	settings               *model.Configuration
 	uuid                   *string
-	log                    *log.Logger
+	log                    *logging.Logger
 	indexerActionWasCalled bool
 }
 
-func (f *SpyFakeAddItem) IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error {
+func (f *SpyFakeAddItem) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string, log *logging.Logger) (model.ItemResult, error) {
 	f.indexerActionWasCalled = true
 	f.settings = settings
 	f.uuid = uuid
 	f.log = log
-	return nil
+	return model.ItemResult{}, nil
 }
 
-func (f *SpyFakeDeleteItem) IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error {
+func (f *SpyFakeDeleteItem) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string, log *logging.Logger) (model.ItemResult, error) {
 	f.indexerActionWasCalled = true
 	f.settings = settings
 	f.uuid = uuid
 	f.log = log
-	return nil
+	return model.ItemResult{}, nil
 }
 
 func TestHandleAction(t *testing.T) {
@@ -48,8 +51,8 @@ func TestHandleAction(t *testing.T) {
 	}
 
 	// test add
-	spy := &SpyFakeAddItem{settings: &configuration, uuid: &uuid, log: log.Default()}
-	err := HandleAction(spy, &configuration, &uuid, log.Default())
+	spy := &SpyFakeAddItem{settings: &configuration, uuid: &uuid, log: logging.Discard()}
+	_, err := HandleAction(context.Background(), spy, &configuration, &uuid, logging.Discard())
 	if err != nil {
 		print(err)
 	}
@@ -58,8 +61,8 @@ func TestHandleAction(t *testing.T) {
 	}
 
 	// test delete
-	spydel := &SpyFakeDeleteItem{settings: &configuration, uuid: &uuid, log: log.Default()}
-	err = HandleAction(spydel, &configuration, &uuid, log.Default())
+	spydel := &SpyFakeDeleteItem{settings: &configuration, uuid: &uuid, log: logging.Discard()}
+	_, err = HandleAction(context.Background(), spydel, &configuration, &uuid, logging.Discard())
 	if err != nil {
 		print(err)
 	}
@@ -68,3 +71,35 @@ func TestHandleAction(t *testing.T) {
 	}
 
 }
+
+type contextIndexer struct {
+	err *error
+}
+
+func (f contextIndexer) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string,
+	log *logging.Logger) (model.ItemResult, error) {
+	*f.err = ctx.Err()
+	return model.ItemResult{}, nil
+}
+
+func TestItemHandlerContext(t *testing.T) {
+	var actionErr error
+	router := NewRouter(logging.Discard())
+	router.Handle(http.MethodPost, "/items/{id}", ItemHandler(&model.Configuration{}, logging.Discard(),
+		contextIndexer{err: &actionErr}, IndexAction))
+	server, cancelServer := context.WithCancel(context.Background())
+	defer cancelServer()
+	// a client disconnect cancels the request context but not the server context of the action
+	ctx, cancelRequest := context.WithCancel(WithServerContext(server))
+	cancelRequest()
+	request := httptest.NewRequest(http.MethodPost, "/items/"+testUuid, nil).WithContext(ctx)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	if actionErr != nil {
+		t.Errorf("expected the action to run after the client disconnected, got %v", actionErr)
+	}
+	cancelServer()
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	if actionErr != context.Canceled {
+		t.Errorf("expected the action to be interrupted at shutdown, got %v", actionErr)
+	}
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	healthOk   = "ok"
+	healthFail = "fail"
+	// healthTimeout limits the time used by the readiness checks.
+	healthTimeout = 10 * time.Second
+)
+
+var errTimeout = errors.New("health check timed out")
+
+// healthCheck verifies a single dependency.
+type healthCheck func(config model.Configuration, logger *logging.Logger) error
+
+// LivenessHandler reports that the service is running.
+func LivenessHandler() http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		writeHealth(response, model.HealthStatus{Status: healthOk}, nil)
+	}
+}
+
+// ReadinessHandler reports whether the service dependencies are available. Solr, the Solr schema, and
+// DSpace are always checked. The directory for OCR files is checked when lazy indexing is used. The
+// response has status 503 if any check fails.
+func ReadinessHandler(config *model.Configuration, logger *logging.Logger) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+		checks := map[string]healthCheck{
+			"solr": func(config model.Configuration, logger *logging.Logger) error {
+				return process.PingSolr(config)
+			},
+			"solr_schema": func(config model.Configuration, logger *logging.Logger) error {
+				return process.CheckSolrSchema(config)
+			},
+			"dspace": process.PingDSpace,
+		}
+		if config.IndexType == process.LazyIndex {
+			checks["xml_file_location"] = func(config model.Configuration, logger *logging.Logger) error {
+				return process.CheckFileLocation(config)
+			}
+		}
+		writeHealth(response, runHealthChecks(*config, checks, logger), logger)
+	}
+}
+
+// runHealthChecks runs the checks concurrently. Checks that do not complete within the health
+// timeout are reported as failed.
+func runHealthChecks(config model.Configuration, checks map[string]healthCheck,
+	logger *logging.Logger) model.HealthStatus {
+	status := model.HealthStatus{Status: healthOk, Checks: make(map[string]model.HealthResult)}
+	var mutex sync.Mutex
+	var wait sync.WaitGroup
+	for name, check := range checks {
+		wait.Add(1)
+		go func(name string, check healthCheck) {
+			defer wait.Done()
+			start := time.Now()
+			done := make(chan error, 1)
+			go func() {
+				done <- check(config, logger)
+			}()
+			var err error
+			select {
+			case err = <-done:
+			case <-time.After(healthTimeout):
+				err = errTimeout
+			}
+			result := model.HealthResult{Status: healthOk, LatencyMs: time.Since(start).Milliseconds()}
+			if err != nil {
+				result.Status = healthFail
+				result.Error = err.Error()
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			status.Checks[name] = result
+			if err != nil {
+				status.Status = healthFail
+			}
+		}(name, check)
+	}
+	wait.Wait()
+	return status
+}
+
+func writeHealth(response http.ResponseWriter, status model.HealthStatus, logger *logging.Logger) {
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	if status.Status != healthOk {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(response).Encode(status); err != nil && logger != nil {
+		logger.Error("Unable to write response.", logging.Err(err))
+	}
+}
@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"testing"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	config := model.Configuration{XmlFileLocation: t.TempDir()}
+	checks := map[string]healthCheck{
+		"xml_file_location": func(config model.Configuration, logger *logging.Logger) error {
+			return process.CheckFileLocation(config)
+		},
+		"solr": func(config model.Configuration, logger *logging.Logger) error {
+			return errors.New("connection refused")
+		},
+	}
+	status := runHealthChecks(config, checks, logging.Discard())
+	if status.Status != healthFail {
+		t.Errorf("expected failed status when a check fails")
+	}
+	if status.Checks["xml_file_location"].Status != healthOk {
+		t.Errorf("expected writable directory check to pass: %s", status.Checks["xml_file_location"].Error)
+	}
+	if status.Checks["solr"].Error != "connection refused" {
+		t.Errorf("expected error for failed check, got %+v", status.Checks["solr"])
+	}
+
+	config.XmlFileLocation = config.XmlFileLocation + "/missing"
+	delete(checks, "solr")
+	if status := runHealthChecks(config, checks, logging.Discard()); status.Status != healthFail {
+		t.Errorf("expected missing directory check to fail")
+	}
+}
@@ -2,18 +2,23 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	"github.com/mspalti/ocrprocessor/model"
 	"github.com/mspalti/ocrprocessor/process"
 	"io"
-	"log"
+	"time"
 )
 
 type Indexer interface {
-	IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error
+	IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string, log *logging.Logger) (model.ItemResult, error)
 }
 
 type GetItem struct{}
@@ -23,92 +28,108 @@ type AddItem struct{}
 type DeleteItem struct{}
 
 // IndexerAction implements the handler interface for GetItem. It is used to test whether OCR files for the
-// DSpace Item UUID are already in the Solr index.
-func (axn GetItem) IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error {
-	exists, err := process.CheckSolr(*settings, *uuid)
+// DSpace Item UUID are already in the Solr index, and returns the indexed page documents. The index is stale
+// if the number of page documents differs from the current number of OCR files in DSpace.
+func (axn GetItem) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string,
+	log *logging.Logger) (model.ItemResult, error) {
+	var result model.ItemResult
+	log = log.With(logging.F(logging.ItemKey, *uuid))
+	status, err := process.ItemIndexStatus(*settings, *uuid)
 	if err != nil {
-		log.Println(err.Error())
-		return err
+		log.Error("Solr query failed", logging.Err(err))
+		return result, err
 	}
-	if !exists {
+	if status.Pages == 0 {
 		// if the item is not in index return 404 error code.
-		return NotFound{ID: *uuid}
+		return result, NotFound{ID: *uuid}
 	}
-	if settings.VerboseLogging {
-		log.Printf("This DSpace Item is already in the Solr index: %s", *uuid)
+	log.Debug("This DSpace Item is already in the Solr index.", logging.F("pages", status.Pages))
+	if files, err := getItemFiles(*settings, *uuid, log); err == nil {
+		pages := files.pageCount()
+		stale := pages != status.Pages
+		status.DSpacePages = &pages
+		status.Stale = &stale
+	} else {
+		log.Warn("Unable to retrieve the OCR files from DSpace for stale detection.", logging.Err(err))
+		result.Warnings = append(result.Warnings, model.PageWarning{Message: "unable to retrieve the OCR " +
+			"files from DSpace, stale detection is not available: " + err.Error()})
 	}
-	return nil
+	result.PagesIndexed = status.Pages
+	result.Index = &status
+	return result, nil
 }
 
 // IndexerAction implements the handler interface for AddItem. It processes OCR files for a given DSpace
 // Item UUID and writes files to disk if lazy loading is requested via configuration. Note that this
 // implementation relies on the DSpace IIIF integration to retrieve OCR files for processing.
-func (axn AddItem) IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error {
-	log.Printf("Processing OCR files for DSpace Item: %s", *uuid)
-	manifestJson, err := process.GetManifest(settings.DSpaceHost, *uuid, log)
-	if err != nil {
-		return err
-	}
-	manifest, err := unMarshallManifest(manifestJson)
+func (axn AddItem) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string,
+	log *logging.Logger) (model.ItemResult, error) {
+	var result model.ItemResult
+	start := time.Now()
+	log = log.With(logging.F(logging.ItemKey, *uuid))
+	log.Info("Processing OCR files for DSpace Item.")
+	files, err := getItemFiles(*settings, *uuid, log)
 	if err != nil {
-		return err
+		return result, err
 	}
-	// retrieve the iiif seeAlso annotation list from DSpace
-	annotationListJson, err := process.GetAnnotationList(manifest.SeeAlso.Id, log)
-	if err != nil {
-		return err
+	manifest, annotationsMap, ocrFiles, usingMets := files.manifest, files.annotations, files.ocrFiles, files.usingMets
+	if usingMets {
+		log.Debug("Using the METS file for the processing order.", logging.F("file_count", len(ocrFiles)))
 	}
-	annotations, err := unMarshallAnnotationList(annotationListJson)
+	// indexed pages are used to skip unchanged pages and to remove pages that were deleted from DSpace
+	indexed, err := process.IndexedPages(*settings, *uuid)
 	if err != nil {
-		return err
-	}
-	// for each Resource, create a map with the file name as the key and the iiif identifier as the value
-	annotationsMap := createAnnotationMap(annotations.Resources)
-	if len(annotationsMap) == 0 {
-		err := UnProcessableEntity{CAUSE: "no annotations exist for this item, nothing to process"}
-		return err
-	}
-	// Processing order determines page identifiers for Solr index entries. These must match Canvas identifiers
-	// in the IIIF manifest. If the identifiers do not align then search results and word highlighting will be
-	// incorrect. The order of OCR files in the DSpace OtherContent Bundle must therefore match the order of your
-	// page images before you attempt Solr indexing.
-	//
-	// For METS/ALTO projects you can alternately use the order of OCR files found in the METS file. To use the
-	// METS file add it to the OtherContent bundle and name the file "mets.xml". If that file is found by
-	// the processor the order of processing will be the METS ordering. This can be helpful when the OtherContent
-	// Bundle order is inaccurate. Note that the OCR file names in METS and the OtherContent Bundle must be
-	// identical when using this approach.
-	var ocrFiles []string
-	usingMets := false
-	if metsReader, err := getMetsFileReader(annotationsMap["mets.xml"], log); err == nil {
-		ocrFiles = getMetsOcrFileNames(metsReader)
-		usingMets = true
-	} else {
-		ocrFiles = getOcrFilesFromAnnotationList(annotations.Resources)
-	}
-	if settings.VerboseLogging {
-		if usingMets {
-			log.Println("Using the METS file for the processing order.")
-			fileCount := len(ocrFiles)
-			log.Printf("Processing %d files for the Item %s", fileCount, *uuid)
-		}
+		log.Warn("Unable to retrieve indexed pages, all pages will be processed.", logging.Err(err))
 	}
+	// the item is known to be new if it has no indexed pages, otherwise only new pages are rolled back
+	newItem := err == nil && len(indexed) == 0
+	var written []process.PageState
+	current := make(map[string]bool)
 	var format process.Format
 	// initialize the ocr file counter
 	var ocrFilePosition = 0
 	// traverse though ordered list of file names
 	for i := 0; i < len(ocrFiles); i++ {
+		// stop between pages if the service is shutting down and remove the partially indexed pages
+		if ctx.Err() != nil {
+			log.Warn("Processing interrupted, removing partially indexed pages.", logging.F("pages_indexed",
+				result.PagesIndexed), logging.F("new_item", newItem))
+			if err := rollback(*settings, *uuid, newItem, written); err != nil {
+				log.Error("Unable to remove partially indexed pages.", logging.Err(err))
+			}
+			return result, ctx.Err()
+		}
 		var ocr []byte
 		if len(ocrFiles[i]) > 0 {
+			name := process.PageName(ocrFiles[i])
+			current[name] = true
+			state, unchanged := indexed[name], reusable(indexed, name, ocrFilePosition, *settings)
+			// compare the checksum in the DSpace bitstream metadata to avoid retrieving unchanged files
+			if unchanged {
+				if sum, err := process.GetBitstreamChecksum(*settings, annotationsMap[ocrFiles[i]], log); err == nil {
+					if sum == state.Checksum {
+						skipPage(&result, ocrFiles[i], log)
+						ocrFilePosition++
+						continue
+					}
+					unchanged = false
+				}
+			}
 			// fetch the file from DSpace
-			ocr, err = process.GetOcrXml(annotationsMap[ocrFiles[i]], log)
+			ocr, err = process.GetOcrXml(*settings, annotationsMap[ocrFiles[i]], log)
 			if err != nil {
-				log.Printf("Failed to retrieve OCR file from DSpace: %s", annotationsMap[ocrFiles[i]])
+				log.Error("Failed to retrieve OCR file from DSpace.", logging.F(logging.FileKey, ocrFiles[i]),
+					logging.F("url", annotationsMap[ocrFiles[i]]), logging.Err(err))
 				if usingMets {
-					log.Println("Check to be sure that the OCR file names in the Bundle match the " +
+					log.Warn("Check to be sure that the OCR file names in the Bundle match the " +
 						"values in your METS file.")
 				}
-				return err
+				return result, err
+			}
+			if unchanged && checksum(ocr) == state.Checksum {
+				skipPage(&result, ocrFiles[i], log)
+				ocrFilePosition++
+				continue
 			}
 			ocrString := string(ocr)
 			var chunk string
@@ -121,6 +142,7 @@ func (axn AddItem) IndexerAction(settings *model.Configuration, uuid *string, lo
 			format = process.GetOcrFormat(chunk)
 		}
 		if len(ocr) != 0 {
+			metrics.Pages.Inc(format.String())
 			var processor process.OcrProcessor
 			switch format {
 			case process.AltoFormat:
@@ -130,44 +152,199 @@ func (axn AddItem) IndexerAction(settings *model.Configuration, uuid *string, lo
 			case process.MiniocrFormat:
 				processor = process.MiniOcrProcessor{}
 			case process.UnknownFormat:
-				log.Printf("ignoring %s file format", format.String())
+				log.Warn("Ignoring unknown OCR file format.", logging.F(logging.FileKey, ocrFiles[i]))
+				result.Warnings = append(result.Warnings, model.PageWarning{FileName: ocrFiles[i],
+					Message: "unknown OCR file format, the file was not indexed"})
 			}
 			if processor != nil {
-				if settings.VerboseLogging {
-					log.Printf("Attempting to process an OCR file in the %s format.", format.String())
-				}
-				err := processor.ProcessOcr(uuid, ocrFiles[i], &ocr, ocrFilePosition, manifest.Id, *settings, log)
+				pageStart := time.Now()
+				pageLog := log.With(logging.F(logging.FileKey, ocrFiles[i]),
+					logging.F(logging.PositionKey, ocrFilePosition), logging.F(logging.FormatKey, format.String()))
+				pageLog.Debug("Attempting to process an OCR file.")
+				page := model.OcrPage{Uuid: *uuid, FileName: ocrFiles[i], Position: ocrFilePosition,
+					Format: format.String(), Manifest: &manifest, SourceUrl: annotationsMap[ocrFiles[i]],
+					Checksum: checksum(ocr), FileSize: &model.FileSize{}}
+				err := processor.ProcessOcr(page, &ocr, *settings, pageLog)
 				if err != nil {
-					log.Printf("OCR processing failure for %s: %s", ocrFiles[i], err.Error())
-					return err
+					pageLog.Error("OCR processing failure.", logging.Err(err))
+					return result, err
+				}
+				result.FileBytes += page.FileSize.Written
+				result.FileBytesSaved += page.FileSize.Original - page.FileSize.Written
+				pageLog.Debug("Processed OCR file.", logging.Duration(pageStart))
+				if _, ok := indexed[process.PageName(ocrFiles[i])]; !ok {
+					written = append(written, writtenPage(*settings, page))
 				}
 				ocrFilePosition++
+				result.PagesIndexed++
 			}
 
 		}
 	}
-	log.Printf("Completed processing item %s with %d OCR files added to the Solr index", *uuid, ocrFilePosition)
-	return nil
+	// remove pages whose OCR files are no longer in DSpace
+	var removed []process.PageState
+	for name, state := range indexed {
+		if !current[name] {
+			removed = append(removed, state)
+		}
+	}
+	if err := process.DeletePages(*settings, *uuid, removed); err != nil {
+		log.Warn("Unable to remove deleted pages.", logging.Err(err))
+		result.Warnings = append(result.Warnings, model.PageWarning{Message: "unable to remove pages that " +
+			"were deleted from DSpace: " + err.Error()})
+	} else {
+		result.PagesRemoved = len(removed)
+	}
+	log.Info("Completed processing item.", logging.F("pages_indexed", result.PagesIndexed),
+		logging.F("pages_skipped", result.PagesSkipped), logging.F("pages_removed", result.PagesRemoved),
+		logging.F("file_bytes", result.FileBytes), logging.F("file_bytes_saved", result.FileBytesSaved),
+		logging.Duration(start))
+	return result, nil
 }
 
 // IndexerAction implements the handler interface for DeleteItem. It deletes all OCR files
 // from the Solr index for a given DSpace Item UUID and removes files from disk if lazy loading is used.
-func (axn DeleteItem) IndexerAction(settings *model.Configuration, uuid *string, log *log.Logger) error {
-	log.Printf("Deleting OCR files for DSpace Item: %s", *uuid)
+func (axn DeleteItem) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string,
+	log *logging.Logger) (model.ItemResult, error) {
+	var result model.ItemResult
+	log = log.With(logging.F(logging.ItemKey, *uuid))
+	log.Info("Deleting OCR files for DSpace Item.")
 	err := process.DeleteFromSolr(*settings, *uuid)
 	if err != nil {
-		log.Printf("Error deleting OCR files from index for the item: %s", err.Error())
-		return err
+		log.Error("Error deleting OCR files from index for the item.", logging.Err(err))
+		return result, err
+	}
+	return result, nil
+}
+
+// itemFiles are the OCR files of a DSpace Item in processing order.
+type itemFiles struct {
+	manifest model.Manifest
+	// annotations maps OCR file names to their DSpace urls
+	annotations map[string]string
+	ocrFiles    []string
+	usingMets   bool
+}
+
+// reusable returns true if the indexed document for the page can be kept when its checksum is unchanged.
+// This requires the checksum and position of the page to be indexed, the page to be at the same position,
+// and, for lazy indexing, the OCR file to exist in storage.
+func reusable(indexed map[string]process.PageState, name string, position int, settings model.Configuration) bool {
+	state, ok := indexed[name]
+	if !ok || len(state.Checksum) == 0 || !state.HasPosition || state.Position != position {
+		return false
+	}
+	if settings.IndexType == process.LazyIndex {
+		if len(state.FilePath) == 0 {
+			return false
+		}
+		if exists, err := process.FileExists(settings, state.FilePath); err != nil || !exists {
+			return false
+		}
+	}
+	return true
+}
+
+// rollback removes the pages written before processing of the item was interrupted. A new item is removed
+// entirely. For an item that was indexed before, only the pages first written in this run are removed and the
+// previously indexed pages are left in place, since they are overwritten by id.
+func rollback(settings model.Configuration, uuid string, newItem bool, written []process.PageState) error {
+	if newItem {
+		return process.RollbackItem(settings, uuid)
+	}
+	return process.DeletePages(settings, uuid, written)
+}
+
+// writtenPage returns the state of a page written in this run, which is needed to remove it again.
+func writtenPage(settings model.Configuration, page model.OcrPage) process.PageState {
+	state := process.PageState{SolrId: process.SolrId(settings, page)}
+	if settings.IndexType == process.LazyIndex {
+		if path, err := process.LazyFilePath(settings, page.Uuid, process.PageName(page.FileName)); err == nil {
+			state.FilePath = path
+		}
+	}
+	return state
+}
+
+// skipPage records an unchanged page that is not processed again.
+func skipPage(result *model.ItemResult, fileName string, log *logging.Logger) {
+	log.Debug("Skipping unchanged OCR file.", logging.F(logging.FileKey, fileName))
+	result.PagesSkipped++
+	result.Skipped = append(result.Skipped, fileName)
+}
+
+// checksum returns the MD5 checksum of the OCR file, which is the default checksum algorithm of DSpace
+// bitstreams.
+func checksum(ocr []byte) string {
+	sum := md5.Sum(ocr)
+	return hex.EncodeToString(sum[:])
+}
+
+// pageCount returns the number of OCR files, not counting the METS file.
+func (files itemFiles) pageCount() int {
+	count := 0
+	for _, name := range files.ocrFiles {
+		if len(name) > 0 && name != "mets.xml" {
+			count++
+		}
+	}
+	return count
+}
+
+// getItemFiles retrieves the IIIF manifest and seeAlso annotation list of the Item from DSpace and returns
+// the OCR files in processing order.
+func getItemFiles(settings model.Configuration, uuid string, log *logging.Logger) (itemFiles, error) {
+	var files itemFiles
+	manifestJson, err := process.GetManifest(settings, uuid, log)
+	if err != nil {
+		return files, err
+	}
+	manifest, err := unMarshallManifest(manifestJson)
+	if err != nil {
+		return files, err
+	}
+	// retrieve the iiif seeAlso annotation list from DSpace
+	annotationListJson, err := process.GetAnnotationList(settings, manifest.SeeAlso.Id, log)
+	if err != nil {
+		return files, err
+	}
+	annotations, err := unMarshallAnnotationList(annotationListJson)
+	if err != nil {
+		return files, err
+	}
+	// for each Resource, create a map with the file name as the key and the iiif identifier as the value
+	annotationsMap := createAnnotationMap(annotations.Resources)
+	if len(annotationsMap) == 0 {
+		err := UnProcessableEntity{CAUSE: "no annotations exist for this item, nothing to process"}
+		return files, err
+	}
+	// Processing order determines page identifiers for Solr index entries. These must match Canvas identifiers
+	// in the IIIF manifest. If the identifiers do not align then search results and word highlighting will be
+	// incorrect. The order of OCR files in the DSpace OtherContent Bundle must therefore match the order of your
+	// page images before you attempt Solr indexing.
+	//
+	// For METS/ALTO projects you can alternately use the order of OCR files found in the METS file. To use the
+	// METS file add it to the OtherContent bundle and name the file "mets.xml". If that file is found by
+	// the processor the order of processing will be the METS ordering. This can be helpful when the OtherContent
+	// Bundle order is inaccurate. Note that the OCR file names in METS and the OtherContent Bundle must be
+	// identical when using this approach.
+	files.manifest = manifest
+	files.annotations = annotationsMap
+	if metsReader, err := getMetsFileReader(settings, annotationsMap["mets.xml"], log); err == nil {
+		files.ocrFiles = getMetsOcrFileNames(metsReader)
+		files.usingMets = true
+	} else {
+		files.ocrFiles = getOcrFilesFromAnnotationList(annotations.Resources)
 	}
-	return nil
+	return files, nil
 }
 
 // getMetsFileReader returns a byte reader for the METS file found in DSpace or an error if the file is not found
-func getMetsFileReader(identifier string, log *log.Logger) (io.Reader, error) {
+func getMetsFileReader(settings model.Configuration, identifier string, log *logging.Logger) (io.Reader, error) {
 	if len(identifier) == 0 {
 		return nil, errors.New("DSpace Bitstream identifier not found for the mets.xml file")
 	}
-	metsResponse, err := process.GetMetsXml(identifier, log)
+	metsResponse, err := process.GetMetsXml(settings, identifier, log)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReusable(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "1234-page1.xml")
+	if err := ioutil.WriteFile(file, []byte("<ocr/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	indexed := map[string]process.PageState{
+		"page1": {SolrId: "1234-page1", FilePath: file, Checksum: "abc", Position: 0, HasPosition: true},
+		"page2": {SolrId: "1234-page2", Checksum: "def", Position: 1, HasPosition: true},
+		"page3": {SolrId: "1234-page3", Position: 2, HasPosition: true},
+	}
+	full := model.Configuration{IndexType: "full"}
+	lazy := model.Configuration{IndexType: "lazy", XmlFileLocation: filepath.Dir(file)}
+	if !reusable(indexed, "page1", 0, lazy) || !reusable(indexed, "page2", 1, full) {
+		t.Errorf("expected unchanged pages at the same position to be reusable")
+	}
+	if reusable(indexed, "page2", 0, full) {
+		t.Errorf("expected page at a new position to be processed")
+	}
+	if reusable(indexed, "page2", 1, lazy) {
+		t.Errorf("expected lazy page without a file to be processed")
+	}
+	if reusable(indexed, "page3", 2, full) || reusable(indexed, "page4", 3, full) {
+		t.Errorf("expected pages without checksum or index entry to be processed")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	var updates []string
+	var route string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		updates = append(updates, strings.TrimSpace(string(body)))
+		route = r.URL.Query().Get("_route_")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	settings := model.Configuration{SolrUrl: server.URL, SolrCore: "core", IndexType: "lazy", XmlFileLocation: dir,
+		ManifestBase: "http://localhost/iiif/"}
+	page := model.OcrPage{Uuid: "1234", FileName: "page3.xml"}
+	written := writtenPage(settings, page)
+	previous := filepath.Join(dir, "1234-page1.xml")
+	for _, file := range []string{written.FilePath, previous} {
+		if err := ioutil.WriteFile(file, []byte("<ocr/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// an interrupted re-index only removes the pages that were new in this run
+	if err := rollback(settings, "1234", false, []process.PageState{written}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0] != `{"delete":["1234-page3"]}` {
+		t.Errorf("expected only the new page to be deleted, got %v", updates)
+	}
+	if _, err := os.Stat(written.FilePath); !os.IsNotExist(err) {
+		t.Errorf("expected the file of the new page to be removed")
+	}
+	if _, err := os.Stat(previous); err != nil {
+		t.Errorf("expected the previously indexed file to be kept: %v", err)
+	}
+	// nothing is removed if all written pages were indexed before
+	updates = nil
+	if err := rollback(settings, "1234", false, nil); err != nil || len(updates) != 0 {
+		t.Errorf("expected no updates, got %v %v", updates, err)
+	}
+	// documents routed by item are deleted by their routed id
+	settings.SolrRouteByItem = true
+	updates = nil
+	if err := rollback(settings, "1234", false, []process.PageState{writtenPage(settings, page)}); err != nil {
+		t.Fatal(err)
+	}
+	if len(updates) != 1 || updates[0] != `{"delete":["1234!1234-page3"]}` || route != "1234!" {
+		t.Errorf("expected the routed id of the new page to be deleted, got %v with route %q", updates, route)
+	}
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"regexp"
+)
+
+// Item actions reported in API responses.
+const (
+	CheckAction  = "check"
+	IndexAction  = "index"
+	DeleteAction = "delete"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ItemHandler returns the http handler that runs the indexer action for the DSpace Item uuid in the id
+// path parameter and writes the result as JSON.
+func ItemHandler(config *model.Configuration, logger *logging.Logger, indexer Indexer, action string) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+		uuid := PathParam(request, "id")
+		body := model.ItemResponse{Id: uuid, Action: action, Status: "ok"}
+		if !uuidPattern.MatchString(uuid) {
+			writeItemError(response, body, BadRequest{URL: request.URL.Path}, logger)
+			return
+		}
+		result, err := HandleAction(serverContext(request), indexer, config, &uuid, logger)
+		recordItemMetrics(action, err)
+		body.PagesIndexed = result.PagesIndexed
+		body.PagesSkipped = result.PagesSkipped
+		body.PagesRemoved = result.PagesRemoved
+		body.FileBytes = result.FileBytes
+		body.FileBytesSaved = result.FileBytesSaved
+		body.Skipped = result.Skipped
+		body.Warnings = result.Warnings
+		body.Index = result.Index
+		if err != nil {
+			writeItemError(response, body, err, logger)
+			return
+		}
+		writeJson(response, body, logger)
+	})
+}
+
+// recordItemMetrics counts the indexing and delete actions by result.
+func recordItemMetrics(action string, err error) {
+	if action != IndexAction && action != DeleteAction {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.Items.Inc(action, result)
+}
+
+func writeItemError(response http.ResponseWriter, body model.ItemResponse, err error, logger *logging.Logger) {
+	status, code := errorStatus(err)
+	logItemError(status, err, logger)
+	body.Status = "error"
+	body.Error = &model.ErrorResponse{Code: code, Message: err.Error()}
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	writeJson(response, body, logger)
+}
+
+// logItemError logs failed requests. Items that are not indexed are expected for GET requests.
+func logItemError(status int, err error, logger *logging.Logger) {
+	if status == http.StatusNotFound {
+		logger.Debug("Request failed.", logging.Err(err))
+		return
+	}
+	logger.Error("Request failed.", logging.Err(err))
+}
+
+// writeError writes the JSON status response for the error.
+func writeError(response http.ResponseWriter, err error, logger *logging.Logger) {
+	status, code := errorStatus(err)
+	writeStatus(response, status, code, err.Error(), logger)
+}
+
+func writeStatus(response http.ResponseWriter, status int, code string, message string, logger *logging.Logger) {
+	logger.Warn("Request failed.", logging.F("status", status), logging.F(logging.ErrorKey, message))
+	response.Header().Set("Content-Type", "application/json")
+	response.WriteHeader(status)
+	writeJson(response, model.StatusResponse{Status: "error", Error: &model.ErrorResponse{Code: code,
+		Message: message}}, logger)
+}
+
+// errorStatus returns the http status and error code for the error type.
+func errorStatus(err error) (int, string) {
+	var badRequest BadRequest
+	var notFound NotFound
+	var methodNotAllowed MethodNotAllowed
+	var unprocessable UnProcessableEntity
+	var unauthorized Unauthorized
+	var forbidden Forbidden
+	switch {
+	case errors.As(err, &badRequest):
+		return http.StatusBadRequest, "bad_request"
+	case errors.As(err, &notFound):
+		return http.StatusNotFound, "not_found"
+	case errors.As(err, &methodNotAllowed):
+		return http.StatusMethodNotAllowed, "method_not_allowed"
+	case errors.As(err, &unprocessable):
+		return http.StatusUnprocessableEntity, "unprocessable_entity"
+	case errors.As(err, &unauthorized):
+		return http.StatusUnauthorized, "unauthorized"
+	case errors.As(err, &forbidden):
+		return http.StatusForbidden, "forbidden"
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, "service_unavailable"
+	}
+	return http.StatusInternalServerError, "internal_error"
+}
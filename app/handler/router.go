@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"context"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ApiPrefix is the path prefix of the versioned http API.
+const ApiPrefix = "/api/v1"
+
+// Router dispatches requests to handlers registered for a method and path pattern. Pattern segments
+// in braces, e.g. /items/{id}, match any single path segment and are available from PathParam.
+// Requests for a registered path with an unsupported method receive a 405 response with an Allow
+// header, and OPTIONS requests receive the Allow header.
+type Router struct {
+	routes []*route
+	logger *logging.Logger
+}
+
+type route struct {
+	segments []string
+	handlers map[string]http.Handler
+}
+
+type paramsKey struct{}
+
+// NewRouter creates an empty router.
+func NewRouter(logger *logging.Logger) *Router {
+	return &Router{logger: logger}
+}
+
+// Handle registers the handler for the method and path pattern.
+func (r *Router) Handle(method string, pattern string, handler http.Handler) {
+	segments := splitPath(pattern)
+	for _, existing := range r.routes {
+		if equalSegments(existing.segments, segments) {
+			existing.handlers[method] = handler
+			return
+		}
+	}
+	r.routes = append(r.routes, &route{segments: segments, handlers: map[string]http.Handler{method: handler}})
+}
+
+// HandleFunc registers the handler function for the method and path pattern.
+func (r *Router) HandleFunc(method string, pattern string, handler http.HandlerFunc) {
+	r.Handle(method, pattern, handler)
+}
+
+func (r *Router) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	path := splitPath(request.URL.Path)
+	for _, route := range r.routes {
+		params, ok := route.match(path)
+		if !ok {
+			continue
+		}
+		handler, ok := route.handlers[request.Method]
+		if !ok {
+			response.Header().Set("Allow", route.allow())
+			if request.Method == http.MethodOptions {
+				response.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeError(response, MethodNotAllowed{URL: request.URL.Path},
+				logging.FromContext(request.Context(), r.logger))
+			return
+		}
+		ctx := context.WithValue(request.Context(), paramsKey{}, params)
+		handler.ServeHTTP(response, request.WithContext(ctx))
+		return
+	}
+	writeStatus(response, http.StatusNotFound, "not_found", "no route for "+request.URL.Path,
+		logging.FromContext(request.Context(), r.logger))
+}
+
+// PathParam returns the value of the named pattern segment for the request.
+func PathParam(request *http.Request, name string) string {
+	params, _ := request.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+func (r *route) match(path []string) (map[string]string, bool) {
+	if len(path) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			params[segment[1:len(segment)-1]] = path[i]
+			continue
+		}
+		if segment != path[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// allow returns the value of the Allow header for the route.
+func (r *route) allow() string {
+	methods := []string{http.MethodOptions}
+	for method := range r.handlers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func equalSegments(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
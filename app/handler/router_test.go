@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testUuid = "413065ef-e242-4d0e-867d-8e2f6486be56"
+
+type fakeIndexer struct {
+	result model.ItemResult
+	err    error
+}
+
+func (f fakeIndexer) IndexerAction(ctx context.Context, settings *model.Configuration, uuid *string,
+	log *logging.Logger) (model.ItemResult, error) {
+	return f.result, f.err
+}
+
+func serve(router *Router, method string, path string) (*httptest.ResponseRecorder, model.ItemResponse) {
+	response := httptest.NewRecorder()
+	router.ServeHTTP(response, httptest.NewRequest(method, path, nil))
+	var body model.ItemResponse
+	_ = json.Unmarshal(response.Body.Bytes(), &body)
+	return response, body
+}
+
+func TestRouter(t *testing.T) {
+	config := &model.Configuration{}
+	router := NewRouter(logging.Discard())
+	router.Handle(http.MethodGet, ApiPrefix+"/items/{id}", ItemHandler(config, logging.Discard(),
+		fakeIndexer{err: NotFound{ID: testUuid}}, CheckAction))
+	router.Handle(http.MethodPost, ApiPrefix+"/items/{id}", ItemHandler(config, logging.Discard(),
+		fakeIndexer{result: model.ItemResult{PagesIndexed: 2, Warnings: []model.PageWarning{{FileName: "p3.txt",
+			Message: "unknown OCR file format"}}}}, IndexAction))
+
+	response, body := serve(router, http.MethodPost, ApiPrefix+"/items/"+testUuid)
+	if response.Code != http.StatusOK || body.Id != testUuid || body.Action != IndexAction ||
+		body.PagesIndexed != 2 || len(body.Warnings) != 1 {
+		t.Errorf("unexpected index response %d: %s", response.Code, response.Body.String())
+	}
+
+	response, body = serve(router, http.MethodGet, ApiPrefix+"/items/"+testUuid)
+	if response.Code != http.StatusNotFound || body.Status != "error" || body.Error.Code != "not_found" {
+		t.Errorf("unexpected check response %d: %s", response.Code, response.Body.String())
+	}
+
+	response, body = serve(router, http.MethodPost, ApiPrefix+"/items/not-a-uuid")
+	if response.Code != http.StatusBadRequest || body.Error.Code != "bad_request" {
+		t.Errorf("expected invalid uuid to be rejected, got %d: %s", response.Code, response.Body.String())
+	}
+
+	response, _ = serve(router, http.MethodPut, ApiPrefix+"/items/"+testUuid)
+	if response.Code != http.StatusMethodNotAllowed || response.Header().Get("Allow") != "GET, OPTIONS, POST" {
+		t.Errorf("expected 405 with Allow header, got %d %q", response.Code, response.Header().Get("Allow"))
+	}
+
+	response, _ = serve(router, http.MethodOptions, ApiPrefix+"/items/"+testUuid)
+	if response.Code != http.StatusNoContent || len(response.Header().Get("Allow")) == 0 {
+		t.Errorf("expected Allow header for OPTIONS, got %d", response.Code)
+	}
+
+	response, _ = serve(router, http.MethodGet, ApiPrefix+"/collections/"+testUuid)
+	if response.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown route, got %d", response.Code)
+	}
+}
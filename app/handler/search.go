@@ -0,0 +1,304 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	searchContext1       = "http://iiif.io/api/search/1/context.json"
+	searchContext2       = "http://iiif.io/api/search/2/context.json"
+	presentationContext2 = "http://iiif.io/api/presentation/2/context.json"
+	// maxTerms limits the number of autocomplete terms.
+	maxTerms = 20
+)
+
+// searchHit is a highlighted term on a canvas. A hit has more than one target if the highlighted
+// phrase spans multiple lines.
+type searchHit struct {
+	position int
+	match    string
+	text     []string
+	targets  []string
+}
+
+// SearchHandler returns the http handler for the IIIF Content Search API of an Item. The version
+// is either 1 (AnnotationList) or 2 (AnnotationPage). The Item uuid is the last path element and
+// the query is the "q" request parameter. Only Items whose manifest DSpace returns to anonymous
+// users can be searched.
+func SearchHandler(config *model.Configuration, logger *logging.Logger, version int) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+		uuid, query, ok := searchParams(response, request, logger)
+		if !ok {
+			return
+		}
+		logger = logger.With(logging.F(logging.ItemKey, uuid))
+		manifest, err := getManifest(*config, uuid, logger)
+		if err != nil {
+			writeSearchError(response, err, logger)
+			return
+		}
+		solrResponse, err := process.SearchSolr(*config, uuid, query)
+		if err != nil {
+			writeSearchError(response, err, logger)
+			return
+		}
+		hits := searchHits(solrResponse, manifest, logger)
+		id := requestUrl(request)
+		if version == 2 {
+			writeJson(response, annotationPage(id, hits), logger)
+		} else {
+			writeJson(response, annotationList(id, hits), logger)
+		}
+	}
+}
+
+// AutocompleteHandler returns the http handler for the IIIF Content Search autocomplete service of an Item.
+// The searchPath is the path of the search service used for term URLs. Like search, autocomplete is
+// limited to Items whose manifest DSpace returns to anonymous users.
+func AutocompleteHandler(config *model.Configuration, logger *logging.Logger, version int,
+	searchPath string) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		logger := logging.FromContext(request.Context(), logger)
+		uuid, query, ok := searchParams(response, request, logger)
+		if !ok {
+			return
+		}
+		logger = logger.With(logging.F(logging.ItemKey, uuid))
+		if _, err := getManifest(*config, uuid, logger); err != nil {
+			writeSearchError(response, err, logger)
+			return
+		}
+		terms, err := process.SuggestTerms(*config, uuid, query, maxTerms)
+		if err != nil {
+			writeSearchError(response, err, logger)
+			return
+		}
+		id := requestUrl(request)
+		if version == 2 {
+			page := model.TermPage{Context: searchContext2, Id: id, Type: "TermPage", Items: make([]model.Term2, 0)}
+			for _, term := range terms {
+				page.Items = append(page.Items, model.Term2{Value: term.Term, Total: term.Count})
+			}
+			writeJson(response, page, logger)
+			return
+		}
+		list := model.TermList{Context: searchContext1, Id: id, Type: "search:TermList", Terms: make([]model.Term, 0)}
+		base := requestBase(request) + searchPath + uuid + "?q="
+		for _, term := range terms {
+			list.Terms = append(list.Terms, model.Term{Match: term.Term, Url: base + url.QueryEscape(term.Term),
+				Count: term.Count})
+		}
+		writeJson(response, list, logger)
+	}
+}
+
+// searchParams returns the Item uuid and query for search requests, writing an error response
+// if the request is invalid. The uuid is validated since it is used in Solr filter queries. Like
+// the router, OPTIONS requests and unsupported methods receive the Allow header.
+func searchParams(response http.ResponseWriter, request *http.Request,
+	logger *logging.Logger) (string, string, bool) {
+	response.Header().Set("Access-Control-Allow-Origin", "*")
+	if request.Method != http.MethodGet {
+		response.Header().Set("Allow", http.MethodGet+", "+http.MethodOptions)
+		if request.Method == http.MethodOptions {
+			response.WriteHeader(http.StatusNoContent)
+			return "", "", false
+		}
+		writeError(response, MethodNotAllowed{URL: request.URL.Path}, logger)
+		return "", "", false
+	}
+	pathParams := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	uuid := pathParams[len(pathParams)-1]
+	query := strings.TrimSpace(request.URL.Query().Get("q"))
+	if len(pathParams) < 2 || !uuidPattern.MatchString(uuid) || len(query) == 0 {
+		writeError(response, BadRequest{URL: request.URL.Path}, logger)
+		return "", "", false
+	}
+	return uuid, query, true
+}
+
+// getManifest retrieves the Item's IIIF manifest from DSpace. The search routes are public, so the
+// manifest is requested without the DSpace credentials of the service and restricted Items are not found.
+func getManifest(config model.Configuration, uuid string, logger *logging.Logger) (model.Manifest, error) {
+	config.DSpaceUser, config.DSpacePassword = "", ""
+	manifestJson, err := process.GetManifest(config, uuid, logger)
+	if err != nil {
+		return model.Manifest{}, err
+	}
+	return unMarshallManifest(manifestJson)
+}
+
+// searchHits converts the OCR highlights to canvas targets. Highlighted pages are mapped to canvases
+// by the position in the page identifier (Page.N) and highlight coordinates are scaled to the
+// canvas dimensions. Hits are returned in page order.
+func searchHits(solrResponse model.SolrHighlightResponse, manifest model.Manifest, logger *logging.Logger) []searchHit {
+	hits := make([]searchHit, 0)
+	for _, fields := range solrResponse.OcrHighlighting {
+		for _, highlights := range fields {
+			for _, snippet := range highlights.Snippets {
+				hits = append(hits, snippetHits(snippet, manifest, logger)...)
+			}
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		return hits[i].position < hits[j].position
+	})
+	return hits
+}
+
+func snippetHits(snippet model.OcrSnippet, manifest model.Manifest, logger *logging.Logger) []searchHit {
+	hits := make([]searchHit, 0, len(snippet.Highlights))
+	for _, highlight := range snippet.Highlights {
+		hit := searchHit{}
+		for _, part := range highlight {
+			if part.ParentRegionIdx < 0 || part.ParentRegionIdx >= len(snippet.Regions) {
+				continue
+			}
+			pageIdx := snippet.Regions[part.ParentRegionIdx].PageIdx
+			if pageIdx < 0 || pageIdx >= len(snippet.Pages) {
+				continue
+			}
+			page := snippet.Pages[pageIdx]
+			position, err := process.PageIndex(page.Id)
+			if err != nil {
+				logger.Warn("Unexpected OCR page identifier.", logging.Err(err))
+				continue
+			}
+			canvas := manifest.Canvas(position)
+			if canvas == nil {
+				logger.Warn("No canvas found in the manifest for OCR page.", logging.F("page_id", page.Id))
+				continue
+			}
+			if len(hit.targets) == 0 {
+				hit.position = position
+			}
+			hit.targets = append(hit.targets, canvas.Id+"#xywh="+fragment(part, page, canvas))
+			hit.text = append(hit.text, part.Text)
+		}
+		if len(hit.targets) > 0 {
+			hit.match = strings.Join(hit.text, " ")
+			hits = append(hits, hit)
+		}
+	}
+	return hits
+}
+
+// fragment returns the xywh media fragment for the highlight on the canvas. Relative coordinates
+// are converted to pixels and coordinates are scaled when the OCR page and canvas dimensions differ.
+func fragment(highlight model.OcrHighlight, page model.OcrPageRef, canvas *model.Canvas) string {
+	ulx, uly, lrx, lry := highlight.Ulx, highlight.Uly, highlight.Lrx, highlight.Lry
+	width, height := page.Width, page.Height
+	if lrx <= 1 && lry <= 1 {
+		// relative coordinates
+		width, height = float64(canvas.Width), float64(canvas.Height)
+		ulx, lrx = ulx*width, lrx*width
+		uly, lry = uly*height, lry*height
+	} else if width > 0 && height > 0 && canvas.Width > 0 && canvas.Height > 0 {
+		scaleX, scaleY := float64(canvas.Width)/width, float64(canvas.Height)/height
+		ulx, lrx = ulx*scaleX, lrx*scaleX
+		uly, lry = uly*scaleY, lry*scaleY
+	}
+	x, y := math.Round(ulx), math.Round(uly)
+	return fmt.Sprintf("%d,%d,%d,%d", int(x), int(y), int(math.Round(lrx)-x), int(math.Round(lry)-y))
+}
+
+// annotationList creates the IIIF Content Search 1.0 response.
+func annotationList(id string, hits []searchHit) model.SearchAnnotationList {
+	list := model.SearchAnnotationList{
+		Context:   []string{presentationContext2, searchContext1},
+		Id:        id,
+		Type:      "sc:AnnotationList",
+		Resources: make([]model.SearchAnnotation, 0),
+		Hits:      make([]model.SearchHit, 0),
+	}
+	count := 0
+	for _, hit := range hits {
+		searchHit := model.SearchHit{Type: "search:Hit", Match: hit.match}
+		for i, target := range hit.targets {
+			annotationId := fmt.Sprintf("%s#annotation-%d", id, count)
+			count++
+			list.Resources = append(list.Resources, model.SearchAnnotation{
+				Id:         annotationId,
+				Type:       "oa:Annotation",
+				Motivation: "sc:painting",
+				Resource:   model.SearchResource{Type: "cnt:ContentAsText", Chars: hit.text[i]},
+				On:         target,
+			})
+			searchHit.Annotations = append(searchHit.Annotations, annotationId)
+		}
+		list.Hits = append(list.Hits, searchHit)
+	}
+	list.Within = model.SearchLayer{Type: "sc:Layer", Total: len(hits)}
+	return list
+}
+
+// annotationPage creates the IIIF Content Search 2.0 response.
+func annotationPage(id string, hits []searchHit) model.SearchAnnotationPage {
+	page := model.SearchAnnotationPage{
+		Context: searchContext2,
+		Id:      id,
+		Type:    "AnnotationPage",
+		Items:   make([]model.SearchAnnotation2, 0),
+	}
+	for _, hit := range hits {
+		for i, target := range hit.targets {
+			page.Items = append(page.Items, model.SearchAnnotation2{
+				Id:         fmt.Sprintf("%s#annotation-%d", id, len(page.Items)),
+				Type:       "Annotation",
+				Motivation: "highlighting",
+				Body:       model.TextualBody{Type: "TextualBody", Value: hit.text[i], Format: "text/plain"},
+				Target:     target,
+			})
+		}
+	}
+	return page
+}
+
+// requestBase returns the scheme and host of the request, honoring the X-Forwarded-Proto header.
+func requestBase(request *http.Request) string {
+	scheme := "http"
+	if request.TLS != nil {
+		scheme = "https"
+	}
+	// the header is removed from requests that do not come from a trusted proxy
+	if forwarded := request.Header.Get("X-Forwarded-Proto"); forwarded == "http" || forwarded == "https" {
+		scheme = forwarded
+	}
+	return scheme + "://" + request.Host
+}
+
+// requestUrl returns the url of the request, used as the identifier of search responses.
+func requestUrl(request *http.Request) string {
+	return requestBase(request) + request.URL.RequestURI()
+}
+
+func writeJson(response http.ResponseWriter, body interface{}, logger *logging.Logger) {
+	response.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(response)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(body); err != nil {
+		logger.Error("Unable to write response.", logging.Err(err))
+	}
+}
+
+func writeSearchError(response http.ResponseWriter, err error, logger *logging.Logger) {
+	logger.Error("Search request failed.", logging.Err(err))
+	var unprocessable UnProcessableEntity
+	if errors.As(err, &unprocessable) {
+		response.WriteHeader(http.StatusNotFound)
+		return
+	}
+	response.WriteHeader(http.StatusInternalServerError)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testHighlightResponse = `{
+  "response": {"numFound": 1, "docs": [{"id": "1234-page2"}]},
+  "ocrHighlighting": {"1234-page2": {"ocr_text": {"numTotal": 1, "snippets": [{
+    "text": "the <em>quick fox</em>",
+    "pages": [{"id": "Page.1", "width": 1000, "height": 2000}],
+    "regions": [{"ulx": 0, "uly": 0, "lrx": 500, "lry": 500, "pageIdx": 0}],
+    "highlights": [[
+      {"text": "quick", "ulx": 100, "uly": 200, "lrx": 150, "lry": 220, "parentRegionIdx": 0},
+      {"text": "fox", "ulx": 10, "uly": 240, "lrx": 40, "lry": 260, "parentRegionIdx": 0}
+    ]]
+  }]}}}
+}`
+
+func TestSearchHits(t *testing.T) {
+	var solrResponse model.SolrHighlightResponse
+	if err := json.Unmarshal([]byte(testHighlightResponse), &solrResponse); err != nil {
+		t.Fatal(err)
+	}
+	manifest := model.Manifest{Sequences: []model.Sequence{{Canvases: []model.Canvas{
+		{Id: "http://localhost/canvas/c0", Width: 2000, Height: 4000},
+		{Id: "http://localhost/canvas/c1", Width: 2000, Height: 4000},
+	}}}}
+	hits := searchHits(solrResponse, manifest, logging.Discard())
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(hits))
+	}
+
+	list := annotationList("http://localhost/search/1234?q=quick+fox", hits)
+	if len(list.Resources) != 2 || len(list.Hits) != 1 || list.Within.Total != 1 {
+		t.Fatalf("unexpected annotation list: %+v", list)
+	}
+	if on := list.Resources[0].On; on != "http://localhost/canvas/c1#xywh=200,400,100,40" {
+		t.Errorf("expected scaled target on the second canvas, got %s", on)
+	}
+	if list.Hits[0].Match != "quick fox" || len(list.Hits[0].Annotations) != 2 {
+		t.Errorf("unexpected hit: %+v", list.Hits[0])
+	}
+
+	page := annotationPage("http://localhost/search/v2/1234?q=quick+fox", hits)
+	if len(page.Items) != 2 || page.Items[1].Body.Value != "fox" {
+		t.Errorf("unexpected annotation page: %+v", page)
+	}
+}
+
+func TestUnmarshallManifest(t *testing.T) {
+	// manifests may use language maps for labels, strings for dimensions, and thumbnail lists
+	manifest, err := unMarshallManifest([]byte(`{
+  "@id": "http://localhost/iiif/1234/manifest",
+  "label": {"en": ["Letters"]},
+  "metadata": [{"label": {"en": ["Title"]}, "value": {"en": ["Letters"], "none": ["Briefe"]}}],
+  "sequences": [{"@id": "http://localhost/iiif/1234/sequence/s0", "canvases": [
+    {"@id": "http://localhost/canvas/c0", "label": {"none": ["p. 1"]}, "width": "2000", "height": "4000",
+      "thumbnail": [{"@id": "http://localhost/thumbnail/c0.jpg"}]},
+    {"@id": "http://localhost/canvas/c1", "label": ["p. 2"], "width": 2000, "height": 4000.0,
+      "thumbnail": "http://localhost/thumbnail/c1.jpg"}
+  ]}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Label != "Letters" || len(manifest.Values("title")) != 2 {
+		t.Errorf("unexpected manifest label or metadata: %q %v", manifest.Label, manifest.Metadata)
+	}
+	first, second := manifest.Canvas(0), manifest.Canvas(1)
+	if first == nil || first.Label != "p. 1" || first.Width != 2000 || first.Height != 4000 ||
+		first.Thumbnail.Id != "http://localhost/thumbnail/c0.jpg" {
+		t.Errorf("unexpected first canvas: %+v", first)
+	}
+	if second == nil || second.Label != "p. 2" || second.Width != 2000 || second.Height != 4000 ||
+		second.Thumbnail.Id != "http://localhost/thumbnail/c1.jpg" {
+		t.Errorf("unexpected second canvas: %+v", second)
+	}
+}
+
+func TestSearchParams(t *testing.T) {
+	// requests are rejected before Solr or DSpace is contacted
+	config := &model.Configuration{}
+	handlers := []http.Handler{SearchHandler(config, logging.Discard(), 1),
+		AutocompleteHandler(config, logging.Discard(), 1, "/search/")}
+	for _, path := range []string{
+		"/autocomplete/x%22%20OR%20*:*%20OR%20%22y?q=a",
+		"/search/1234?q=fox",
+		"/search/413065ef-e242-4d0e-867d-8e2f6486be56",
+	} {
+		for _, handler := range handlers {
+			response := httptest.NewRecorder()
+			handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, path, nil))
+			var body model.StatusResponse
+			_ = json.Unmarshal(response.Body.Bytes(), &body)
+			if response.Code != http.StatusBadRequest || body.Error == nil || body.Error.Code != "bad_request" {
+				t.Errorf("%s: expected 400 with an error body, got %d %s", path, response.Code, response.Body)
+			}
+		}
+	}
+	for _, handler := range handlers {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodPost, "/search/"+testUuid+"?q=fox", nil))
+		if response.Code != http.StatusMethodNotAllowed || response.Header().Get("Allow") != "GET, OPTIONS" {
+			t.Errorf("expected 405 with the Allow header, got %d %q", response.Code, response.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestSearchRestrictedItem(t *testing.T) {
+	// DSpace only returns the manifest of restricted Items to authenticated users
+	authenticated := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.Header.Get("Authorization")) > 0 || strings.Contains(r.URL.Path, "authn") {
+			authenticated = true
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	config := &model.Configuration{DSpaceHost: server.URL, DSpaceUser: "user@dspace.edu", DSpacePassword: "secret"}
+	handlers := []http.Handler{SearchHandler(config, logging.Discard(), 1),
+		AutocompleteHandler(config, logging.Discard(), 1, "/search/")}
+	for _, handler := range handlers {
+		response := httptest.NewRecorder()
+		handler.ServeHTTP(response, httptest.NewRequest(http.MethodGet, "/search/"+testUuid+"?q=fox", nil))
+		if response.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for a restricted Item, got %d", response.Code)
+		}
+	}
+	if authenticated {
+		t.Errorf("expected the manifest to be requested without the DSpace credentials")
+	}
+}
@@ -0,0 +1,224 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotatedTimeFormat is the timestamp added to the names of rotated log files.
+const rotatedTimeFormat = "20060102T150405.000"
+
+// FileOptions configure rotation of a log file.
+type FileOptions struct {
+	// MaxSize is the size in bytes at which the file is rotated. Zero disables size based rotation.
+	MaxSize int64
+	// Interval is the time after which the file is rotated. Zero disables time based rotation.
+	Interval time.Duration
+	// MaxBackups is the number of rotated files to keep. Zero keeps all rotated files.
+	MaxBackups int
+	// Compress enables gzip compression of rotated files.
+	Compress bool
+}
+
+// File is a log file writer that rotates the file by size or age, removes old rotated files, and
+// can reopen the file after it has been moved by an external tool such as logrotate. A File is
+// safe for concurrent use.
+type File struct {
+	mutex   sync.Mutex
+	path    string
+	options FileOptions
+	file    *os.File
+	size    int64
+	opened  time.Time
+	// rotated sends rotated files to the cleanup goroutine, which closes cleaned when it exits.
+	rotated chan string
+	cleaned chan struct{}
+}
+
+// OpenFile opens the log file for appending, creating the file and its directory if necessary.
+func OpenFile(path string, options FileOptions) (*File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f := &File{path: path, options: options}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write writes to the log file, rotating the file first if it has reached the maximum size or age.
+func (f *File) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.rotationDue(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the log file.
+func (f *File) Reopen() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Close closes the log file and waits for the cleanup of rotated files.
+func (f *File) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.rotated != nil {
+		close(f.rotated)
+		<-f.cleaned
+		f.rotated, f.cleaned = nil, nil
+	}
+	return f.close()
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.opened = time.Now()
+	return nil
+}
+
+func (f *File) close() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *File) rotationDue(length int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.options.MaxSize > 0 && f.size+length > f.options.MaxSize {
+		return true
+	}
+	return f.options.Interval > 0 && time.Since(f.opened) >= f.options.Interval
+}
+
+// rotate renames the current file with a timestamp suffix and opens a new file. Compression and
+// removal of old files run in the background so that logging is not delayed. A single goroutine
+// cleans up rotated files in order, so that removal does not race with the compression of a file.
+func (f *File) rotate() error {
+	if err := f.close(); err != nil {
+		return err
+	}
+	rotated := f.path + "." + time.Now().Format(rotatedTimeFormat)
+	if err := os.Rename(f.path, rotated); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if !f.options.Compress && f.options.MaxBackups == 0 {
+		return nil
+	}
+	if f.rotated == nil {
+		f.rotated, f.cleaned = make(chan string, 16), make(chan struct{})
+		go f.cleanup(f.rotated, f.cleaned)
+	}
+	f.rotated <- rotated
+	return nil
+}
+
+func (f *File) cleanup(rotated <-chan string, cleaned chan<- struct{}) {
+	defer close(cleaned)
+	for file := range rotated {
+		if f.options.Compress {
+			if err := compressFile(file); err != nil {
+				_, _ = io.WriteString(os.Stderr, "unable to compress log file: "+err.Error()+"\n")
+			}
+		}
+		if f.options.MaxBackups > 0 {
+			removeBackups(f.path, f.options.MaxBackups)
+		}
+	}
+}
+
+// removeBackups removes the oldest rotated files so that at most max files remain. Only files named
+// like rotated files, with the timestamp suffix and optional .gz extension, are counted and removed.
+func removeBackups(path string, max int) {
+	entries, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+	prefix := filepath.Base(path) + "."
+	var backups []string
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), prefix) || entry.IsDir() {
+			continue
+		}
+		suffix := strings.TrimSuffix(strings.TrimPrefix(entry.Name(), prefix), ".gz")
+		if _, err := time.Parse(rotatedTimeFormat, suffix); err == nil {
+			backups = append(backups, filepath.Join(filepath.Dir(path), entry.Name()))
+		}
+	}
+	// the timestamp suffix sorts rotated files from oldest to newest
+	sort.Strings(backups)
+	for len(backups) > max {
+		_ = os.Remove(backups[0])
+		backups = backups[1:]
+	}
+}
+
+func compressFile(path string) error {
+	if strings.HasSuffix(path, ".gz") {
+		return nil
+	}
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(target)
+	if _, err := io.Copy(writer, source); err != nil {
+		_ = target.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		_ = target.Close()
+		return err
+	}
+	if err := target.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
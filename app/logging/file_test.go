@@ -0,0 +1,104 @@
+package logging
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileRotation(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "logs", "ocr_processor.log")
+	file, err := OpenFile(path, FileOptions{MaxSize: 10, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, entry := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := file.Write([]byte(entry)); err != nil {
+			t.Fatal(err)
+		}
+		// rotated file names have millisecond timestamps
+		time.Sleep(2 * time.Millisecond)
+	}
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "third\n" {
+		t.Errorf("expected current file to hold the last entry, got %q", string(content))
+	}
+	// old files are removed in the background
+	deadline := time.Now().Add(time.Second)
+	for {
+		backups, _ := filepath.Glob(path + ".*")
+		if len(backups) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a single rotated file, got %v", backups)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFileReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ocr_processor.log")
+	file, err := OpenFile(path, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, _ = file.Write([]byte("before\n"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = file.Write([]byte("after\n"))
+	content, _ := ioutil.ReadFile(path)
+	if string(content) != "after\n" {
+		t.Errorf("expected new file after reopen, got %q", string(content))
+	}
+}
+
+func TestRemoveBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ocr_processor.log")
+	names := []string{
+		"ocr_processor.log.20240101T000000.000.gz",
+		"ocr_processor.log.20240102T000000.000",
+		"ocr_processor.log.20240103T000000.000",
+		// files of other tools are kept
+		"ocr_processor.log.1",
+		"ocr_processor.log.old",
+	}
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("entry\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeBackups(path, 1)
+	for i, name := range names {
+		_, err := os.Stat(filepath.Join(dir, name))
+		if removed := os.IsNotExist(err); removed != (i < 2) {
+			t.Errorf("%s: expected removed to be %t", name, i < 2)
+		}
+	}
+}
+
+func TestCompressFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ocr_processor.log.1")
+	if err := ioutil.WriteFile(path, []byte("entry\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := compressFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".gz"); err != nil {
+		t.Errorf("expected compressed file: %s", err.Error())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected uncompressed file to be removed")
+	}
+}
@@ -0,0 +1,198 @@
+// Package logging provides leveled, structured logging with JSON output.
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry.
+type Level int
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+// Standard field keys.
+const (
+	RequestIdKey = "request_id"
+	ItemKey      = "item_uuid"
+	FileKey      = "file_name"
+	PositionKey  = "page_position"
+	FormatKey    = "format"
+	DurationKey  = "duration_ms"
+	ErrorKey     = "error"
+)
+
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	}
+	return "error"
+}
+
+// ParseLevel returns the level for its name (debug, info, warn, or error).
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "debug":
+		return DebugLevel, nil
+	case "info", "":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level: %s", name)
+}
+
+// Field is a key and value added to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F creates a log field.
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err creates the error field.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: ErrorKey, Value: nil}
+	}
+	return Field{Key: ErrorKey, Value: err.Error()}
+}
+
+// Duration creates the duration field with the time elapsed since start in milliseconds.
+func Duration(start time.Time) Field {
+	return Field{Key: DurationKey, Value: time.Since(start).Milliseconds()}
+}
+
+// output is shared by a logger and the loggers derived from it with With.
+type output struct {
+	mutex  sync.Mutex
+	writer io.Writer
+	level  Level
+}
+
+// Logger writes log entries as JSON lines. A Logger is safe for concurrent use.
+type Logger struct {
+	out    *output
+	fields []Field
+}
+
+// New creates a logger that writes entries at or above the level.
+func New(writer io.Writer, level Level) *Logger {
+	return &Logger{out: &output{writer: writer, level: level}}
+}
+
+// With returns a logger that adds the fields to every entry.
+func (l *Logger) With(fields ...Field) *Logger {
+	combined := make([]Field, 0, len(l.fields)+len(fields))
+	combined = append(combined, l.fields...)
+	combined = append(combined, fields...)
+	return &Logger{out: l.out, fields: combined}
+}
+
+// SetLevel changes the minimum level of the logger and the loggers derived from it.
+func (l *Logger) SetLevel(level Level) {
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	l.out.level = level
+}
+
+// SetOutput changes the writer of the logger and the loggers derived from it.
+func (l *Logger) SetOutput(writer io.Writer) {
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	l.out.writer = writer
+}
+
+// Enabled returns true if entries at the level are written.
+func (l *Logger) Enabled(level Level) bool {
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	return level >= l.out.level
+}
+
+// Debug writes a debug entry.
+func (l *Logger) Debug(msg string, fields ...Field) {
+	l.log(DebugLevel, msg, fields)
+}
+
+// Info writes an info entry.
+func (l *Logger) Info(msg string, fields ...Field) {
+	l.log(InfoLevel, msg, fields)
+}
+
+// Warn writes a warning entry.
+func (l *Logger) Warn(msg string, fields ...Field) {
+	l.log(WarnLevel, msg, fields)
+}
+
+// Error writes an error entry.
+func (l *Logger) Error(msg string, fields ...Field) {
+	l.log(ErrorLevel, msg, fields)
+}
+
+func (l *Logger) log(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buffer bytes.Buffer
+	buffer.WriteString(`{"time":`)
+	writeValue(&buffer, time.Now().Format(time.RFC3339Nano))
+	buffer.WriteString(`,"level":`)
+	writeValue(&buffer, level.String())
+	buffer.WriteString(`,"msg":`)
+	writeValue(&buffer, msg)
+	for _, field := range l.fields {
+		writeField(&buffer, field)
+	}
+	for _, field := range fields {
+		writeField(&buffer, field)
+	}
+	buffer.WriteString("}\n")
+	l.out.mutex.Lock()
+	defer l.out.mutex.Unlock()
+	_, _ = l.out.writer.Write(buffer.Bytes())
+}
+
+func writeField(buffer *bytes.Buffer, field Field) {
+	buffer.WriteByte(',')
+	writeValue(buffer, field.Key)
+	buffer.WriteByte(':')
+	if err, ok := field.Value.(error); ok {
+		writeValue(buffer, err.Error())
+		return
+	}
+	writeValue(buffer, field.Value)
+}
+
+func writeValue(buffer *bytes.Buffer, value interface{}) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	buffer.Write(encoded)
+}
+
+// Discard returns a logger that discards all entries.
+func Discard() *Logger {
+	return New(io.Discard, ErrorLevel+1)
+}
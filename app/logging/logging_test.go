@@ -0,0 +1,52 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLoggerWritesJsonFields(t *testing.T) {
+	var buffer bytes.Buffer
+	logger := New(&buffer, InfoLevel).With(F(ItemKey, "1234"))
+	logger.Debug("ignored")
+	logger.Error("failed", F(PositionKey, 2), Err(errors.New("timeout")))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil {
+		t.Fatalf("expected a single JSON entry: %s", buffer.String())
+	}
+	if entry["level"] != "error" || entry["msg"] != "failed" || entry[ItemKey] != "1234" ||
+		entry[PositionKey] != float64(2) || entry[ErrorKey] != "timeout" {
+		t.Errorf("unexpected entry: %v", entry)
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	var buffer bytes.Buffer
+	handler := RequestId(New(&buffer, InfoLevel), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), nil).Info("handled")
+	}))
+
+	request := httptest.NewRequest(http.MethodGet, "/status", nil)
+	request.Header.Set(RequestIdHeader, "abc-123")
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if response.Header().Get(RequestIdHeader) != "abc-123" {
+		t.Errorf("expected request id to be returned")
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); err != nil || entry[RequestIdKey] != "abc-123" {
+		t.Errorf("expected request id in log entry: %s", buffer.String())
+	}
+
+	request.Header.Set(RequestIdHeader, "bad id\n")
+	response = httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	if id := response.Header().Get(RequestIdHeader); len(id) != 32 {
+		t.Errorf("expected generated request id, got %q", id)
+	}
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIdHeader is the http header used to propagate request identifiers.
+const RequestIdHeader = "X-Request-ID"
+
+// maxRequestIdLength limits the length of request identifiers accepted from clients.
+const maxRequestIdLength = 128
+
+type contextKey struct{}
+
+// FromContext returns the request logger stored in the context, or the fallback logger.
+func FromContext(ctx context.Context, fallback *Logger) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok {
+		return logger
+	}
+	return fallback
+}
+
+// NewContext returns a context that carries the logger.
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// RequestId wraps the handler to assign a request identifier to each request. The identifier is
+// taken from the X-Request-ID request header or generated, returned in the X-Request-ID response
+// header, and added to the request logger available from FromContext.
+func RequestId(logger *Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		id := request.Header.Get(RequestIdHeader)
+		if !validRequestId(id) {
+			id = newRequestId()
+		}
+		response.Header().Set(RequestIdHeader, id)
+		requestLogger := logger.With(F(RequestIdKey, id))
+		next.ServeHTTP(response, request.WithContext(NewContext(request.Context(), requestLogger)))
+	})
+}
+
+// validRequestId returns true if the identifier is non-empty, not too long, and printable ASCII.
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(id)
+}
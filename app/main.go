@@ -1,177 +1,777 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
-	. "github.com/mspalti/ocrprocessor/err"
+	"flag"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/auth"
 	. "github.com/mspalti/ocrprocessor/handler"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	. "github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"github.com/mspalti/ocrprocessor/storage"
+	"github.com/mspalti/ocrprocessor/tlsconfig"
 	"github.com/spf13/viper"
-	"log"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const configFilePath = "."
 
-var logger *log.Logger
+// rollbackTimeout is the time allowed for interrupted requests to remove partially indexed items
+// during shutdown.
+const rollbackTimeout = 30 * time.Second
+
+// envPrefix is the prefix for environment variables that override configuration values.
+const envPrefix = "OCR_PROCESSOR"
+
+// tenantName matches tenant names, which are used in route paths.
+var tenantName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tenantPaths are the paths that each tenant serves below its /t/{name} prefix.
+var tenantPaths = []string{ApiPrefix + "/", "/item/", "/search/", "/autocomplete/", "/health/ready"}
+
+var logger *logging.Logger
 
 func config() (*Configuration, error) {
 	viper.SetConfigName("config")
 	viper.SetConfigType("yaml")
 	dir := filepath.ToSlash(configFilePath)
 	viper.AddConfigPath(dir)
+	// every key can be overridden by an environment variable, e.g. OCR_PROCESSOR_SOLR_CORE
+	viper.SetEnvPrefix(envPrefix)
+	viper.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	viper.AutomaticEnv()
+	viper.SetDefault("http_read_timeout", "30s")
+	viper.SetDefault("http_write_timeout", "30m")
+	viper.SetDefault("http_idle_timeout", "2m")
+	viper.SetDefault("shutdown_timeout", "1m")
+	viper.SetDefault("poll_state_file", "./poll_state.json")
+	viper.SetDefault("lazy_file_layout", process.DefaultFileLayout)
+	viper.SetDefault("lazy_file_compression", process.NoCompression)
+	viper.SetDefault("lazy_storage", storage.LocalStorage)
+	viper.SetDefault("lazy_file_mode", "0644")
+	viper.SetDefault("lazy_dir_mode", "0755")
+	viper.SetDefault("input_image_resolution", 300)
 
 	err := viper.ReadInConfig() // Find and read the config file
 	if err != nil {             // Handle errors reading the config file
-		return &Configuration{}, errors.New("fatal error reading config file" + err.Error())
+		return nil, configErrors{"fatal error reading config file: " + err.Error()}
+	}
+	// problems of the remaining values are collected, so that they are reported together
+	var problems configErrors
+	secrets, err := configSecrets("dspace_user", "dspace_password", "solr_username", "solr_password", "solr_token",
+		"s3_access_key", "s3_secret_key")
+	problems.check(err)
+	var solrFields SolrFields
+	if err := viper.UnmarshalKey("solr_fields", &solrFields); err != nil {
+		problems.add("invalid solr_fields configuration: %v", err)
 	}
+	configEnvFields("solr_fields", &solrFields)
+	var metadataFields []MetadataField
+	if err := configList("metadata_fields", &metadataFields); err != nil {
+		problems.add("invalid metadata_fields configuration: %v", err)
+	}
+	apiKeys, err := configApiKeys()
+	problems.check(err)
+	var tenants []Tenant
+	if err := configList("tenants", &tenants); err != nil {
+		problems.add("invalid tenants configuration: %v", err)
+	}
+	for i := range tenants {
+		problems.check(configTenantSecrets(&tenants[i]))
+	}
+	// invalid values are reported by validateConfig
+	fileMode, _ := configFileMode("lazy_file_mode")
+	dirMode, _ := configFileMode("lazy_dir_mode")
 	config := Configuration{
-		DSpaceHost:       viper.GetString("dspace_host"),
-		ManifestBase:     viper.GetString("manifest_base"),
-		Collections:      viper.GetStringSlice("Collections"),
-		SolrUrl:          viper.GetString("solr_url"),
-		SolrCore:         viper.GetString("solr_core"),
-		IndexType:        viper.GetString("index_type"),
-		ConvertToMiniOcr: viper.GetBool("miniocr_conversion"),
-		EscapeUtf8:       viper.GetBool("escape_utf8"),
-		XmlFileLocation:  viper.GetString("xml_file_location"),
-		HttpPort:         viper.GetString("http_port"),
-		IpWhitelist:      viper.GetStringSlice("ip_whitelist"),
-		VerboseLogging:   viper.GetBool("verbose_logging"),
-		LogDir:           viper.GetString("log_dir"),
+		DSpaceHost:           viper.GetString("dspace_host"),
+		DSpaceUser:           secrets["dspace_user"],
+		DSpacePassword:       secrets["dspace_password"],
+		ManifestBase:         viper.GetString("manifest_base"),
+		Collections:          viper.GetStringSlice("collections"),
+		PollInterval:         viper.GetDuration("poll_interval"),
+		PollStateFile:        viper.GetString("poll_state_file"),
+		PollConfiguration:    viper.GetString("poll_configuration"),
+		SolrUrl:              viper.GetString("solr_url"),
+		SolrUrls:             viper.GetStringSlice("solr_urls"),
+		SolrCore:             viper.GetString("solr_core"),
+		SolrCloud:            viper.GetBool("solr_cloud"),
+		SolrRouteByItem:      viper.GetBool("solr_route_by_item"),
+		SolrFields:           solrFields,
+		MetadataFields:       metadataFields,
+		SolrUsername:         secrets["solr_username"],
+		SolrPassword:         secrets["solr_password"],
+		SolrToken:            secrets["solr_token"],
+		SolrCaFile:           viper.GetString("solr_ca_file"),
+		SolrClientCert:       viper.GetString("solr_client_cert"),
+		SolrClientKey:        viper.GetString("solr_client_key"),
+		IndexType:            viper.GetString("index_type"),
+		ConvertToMiniOcr:     viper.GetBool("miniocr_conversion"),
+		EscapeUtf8:           viper.GetBool("escape_utf8"),
+		XmlFileLocation:      viper.GetString("xml_file_location"),
+		LazyFileLayout:       viper.GetString("lazy_file_layout"),
+		LazyFileCompression:  viper.GetString("lazy_file_compression"),
+		LazyStorage:          viper.GetString("lazy_storage"),
+		S3Endpoint:           viper.GetString("s3_endpoint"),
+		S3Region:             viper.GetString("s3_region"),
+		S3Bucket:             viper.GetString("s3_bucket"),
+		S3Prefix:             viper.GetString("s3_prefix"),
+		S3AccessKey:          secrets["s3_access_key"],
+		S3SecretKey:          secrets["s3_secret_key"],
+		S3PathStyle:          viper.GetBool("s3_path_style"),
+		LazyFileMode:         fileMode,
+		LazyDirMode:          dirMode,
+		LazyFileOwner:        viper.GetString("lazy_file_owner"),
+		LazyFileGroup:        viper.GetString("lazy_file_group"),
+		HttpPort:             viper.GetString("http_port"),
+		HttpBindAddress:      viper.GetString("http_bind_address"),
+		TlsCertFile:          viper.GetString("tls_cert_file"),
+		TlsKeyFile:           viper.GetString("tls_key_file"),
+		TlsClientCaFile:      viper.GetString("tls_client_ca_file"),
+		TlsClientAuth:        viper.GetString("tls_client_auth"),
+		HttpReadTimeout:      viper.GetDuration("http_read_timeout"),
+		HttpWriteTimeout:     viper.GetDuration("http_write_timeout"),
+		HttpIdleTimeout:      viper.GetDuration("http_idle_timeout"),
+		ShutdownTimeout:      viper.GetDuration("shutdown_timeout"),
+		HealthCheckItem:      viper.GetString("health_check_item"),
+		InputImageResolution: viper.GetInt("input_image_resolution"),
+		IpWhitelist:          viper.GetStringSlice("ip_whitelist"),
+		TrustedProxies:       viper.GetStringSlice("trusted_proxies"),
+		ApiKeys:              apiKeys,
+		Tenants:              tenants,
+		LogLevel:             logLevel(),
+		LogDir:               viper.GetString("log_dir"),
+		LogOutput:            viper.GetString("log_output"),
+		LogMaxSize:           viper.GetInt("log_max_size"),
+		LogRotateInterval:    viper.GetDuration("log_rotate_interval"),
+		LogMaxBackups:        viper.GetInt("log_max_backups"),
+		LogCompress:          viper.GetBool("log_compress"),
+	}
+	if len(problems) > 0 {
+		return &config, problems
 	}
-
 	return &config, nil
 }
 
-// checkWhitelist verify that the host is in the whitelist from configuration
-func checkWhitelist(request *http.Request, whitelist []string) bool {
-	ip, _, _ := net.SplitHostPort(request.RemoteAddr)
-	ipString := net.ParseIP(ip).String()
-	var inWhitelist = false
-	if len(whitelist) == 0 {
-		inWhitelist = true
+// tenantConfigs returns the configuration of each tenant. Tenant names must be unique and contain only
+// letters, digits, - and _, tenants cannot share a Solr core or lazy file location with another tenant or
+// the top level configuration, and API keys can only be restricted to configured tenants.
+func tenantConfigs(config *Configuration) ([]*Configuration, error) {
+	names := make(map[string]bool)
+	var configs []*Configuration
+	for _, tenant := range config.Tenants {
+		if !tenantName.MatchString(tenant.Name) {
+			return nil, fmt.Errorf("invalid tenant name %q: expected letters, digits, - and _", tenant.Name)
+		}
+		if names[tenant.Name] {
+			return nil, fmt.Errorf("duplicate tenant name %q", tenant.Name)
+		}
+		names[tenant.Name] = true
+		tenantConfig := tenant.Apply(*config)
+		configs = append(configs, &tenantConfig)
 	}
-	for _, x := range whitelist {
-		if x == ipString {
-			inWhitelist = true
-			break
+	if err := checkShared(append([]*Configuration{config}, configs...)); err != nil {
+		return nil, err
+	}
+	for _, key := range config.ApiKeys {
+		if len(key.Tenant) > 0 && !names[key.Tenant] {
+			return nil, fmt.Errorf("api key %q has unknown tenant %q", key.Name, key.Tenant)
 		}
 	}
-	return inWhitelist
+	return configs, nil
 }
 
-func statusHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	_, err := w.Write([]byte("The OCR processor service is running."))
-	if err != nil {
-		log.Fatal(err)
+// configEnvFields sets the string fields of the struct read from the configuration key to the environment
+// variables named after the key and the field, e.g. OCR_PROCESSOR_SOLR_FIELDS_OCR_TEXT.
+func configEnvFields(key string, fields interface{}) {
+	value := reflect.ValueOf(fields).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		tag := value.Type().Field(i).Tag.Get("mapstructure")
+		envKey := envPrefix + "_" + strings.ToUpper(key+"_"+tag)
+		if env, ok := os.LookupEnv(envKey); ok && value.Field(i).Kind() == reflect.String {
+			value.Field(i).SetString(env)
+		}
 	}
-	return
 }
 
-func indexingHandler(config *Configuration, logger *log.Logger) http.HandlerFunc {
-	return func(response http.ResponseWriter, request *http.Request) {
-		// verify that the remote host is in whitelist
-		inWhitelist := checkWhitelist(request, config.IpWhitelist)
-		if !inWhitelist {
-			handleError(errors.New("request refused because remote address is not in whitelist"),
-				response, 403)
-			return
+// configList decodes the list of the configuration key. The list can be replaced by a JSON array in the
+// environment variable of the key, e.g. OCR_PROCESSOR_TENANTS='[{"name": "library", "solr_core": "library"}]'.
+func configList(key string, list interface{}) error {
+	env, ok := os.LookupEnv(envPrefix + "_" + strings.ToUpper(key))
+	if !ok {
+		return viper.UnmarshalKey(key, list)
+	}
+	var value []interface{}
+	if err := json.Unmarshal([]byte(env), &value); err != nil {
+		return fmt.Errorf("%s_%s is not a JSON array: %v", envPrefix, strings.ToUpper(key), err)
+	}
+	// the values are decoded like those of config.yml
+	decoder := viper.New()
+	decoder.Set(key, value)
+	return decoder.UnmarshalKey(key, list)
+}
+
+// checkShared returns an error if two configurations use the same Solr core, or overlapping lazy file
+// locations, since the audit and file removal of one would affect the other.
+func checkShared(configs []*Configuration) error {
+	name := func(settings *Configuration) string {
+		if len(settings.Tenant) == 0 {
+			return "the top level configuration"
+		}
+		return "tenant " + settings.Tenant
+	}
+	cores := make(map[string]*Configuration)
+	for i, settings := range configs {
+		urls := settings.SolrUrls
+		if len(urls) == 0 {
+			urls = []string{settings.SolrUrl}
+		}
+		for _, solrUrl := range urls {
+			core := strings.TrimSuffix(solrUrl, "/") + "/" + settings.SolrCore
+			if other, ok := cores[core]; ok && other != settings {
+				return fmt.Errorf("%s uses the Solr core %s of %s", name(settings), core, name(other))
+			}
+			cores[core] = settings
+		}
+		if settings.IndexType != process.LazyIndex {
+			continue
 		}
+		for _, other := range configs[:i] {
+			if other.IndexType != process.LazyIndex {
+				continue
+			}
+			if nestedPath(settings.XmlFileLocation, other.XmlFileLocation) {
+				return fmt.Errorf("%s uses the xml_file_location %s of %s", name(settings),
+					settings.XmlFileLocation, name(other))
+			}
+			if settings.LazyStorage == storage.S3Storage && other.LazyStorage == storage.S3Storage &&
+				settings.S3Endpoint == other.S3Endpoint && settings.S3Bucket == other.S3Bucket &&
+				(strings.HasPrefix(settings.S3Prefix, other.S3Prefix) || strings.HasPrefix(other.S3Prefix, settings.S3Prefix)) {
+				return fmt.Errorf("%s uses the s3_prefix %q of %s", name(settings), settings.S3Prefix, name(other))
+			}
+		}
+	}
+	return nil
+}
 
-		// get the iiif identifier from the http request
-		pathParams := strings.Split(request.URL.Path, "/")[1:]
-		if !(len(pathParams) >= 2) {
-			handleError(errors.New("missing parameter"), response, 400)
-			return
+// nestedPath returns true if the paths are the same or one is in the other.
+func nestedPath(a string, b string) bool {
+	within := func(path string, dir string) bool {
+		rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+		return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+	}
+	return within(a, b) || within(b, a)
+}
+
+// configFileMode returns the octal file permissions of the configuration key, e.g. "0640".
+func configFileMode(key string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(viper.GetString(key), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid %s %q: expected octal permissions such as 0644", key, viper.GetString(key))
+	}
+	return os.FileMode(mode), nil
+}
+
+// configSecrets returns the values of configuration keys that may hold credentials. Each value is read
+// from the first of these that is set: the environment variable (e.g. OCR_PROCESSOR_SOLR_PASSWORD),
+// the file named by the environment variable with a _FILE suffix (e.g. OCR_PROCESSOR_SOLR_PASSWORD_FILE),
+// the file named by the configuration key with a _file suffix (e.g. solr_password_file), and finally
+// the configuration key itself.
+func configSecrets(keys ...string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	var problems configErrors
+	for _, key := range keys {
+		value, err := configSecret(envPrefix+"_"+strings.ToUpper(key), viper.GetString(key+"_file"), viper.GetString(key))
+		if err != nil {
+			problems.add("unable to read secret file for %s: %v", key, err)
+			continue
+		}
+		secrets[key] = value
+	}
+	if len(problems) > 0 {
+		return secrets, problems
+	}
+	return secrets, nil
+}
+
+// configSecret returns the value of the environment variable, the content of the file named by the
+// environment variable with a _FILE suffix, the content of the configured file, or the configured value.
+func configSecret(envKey string, file string, value string) (string, error) {
+	if env, ok := os.LookupEnv(envKey); ok {
+		return env, nil
+	}
+	if envFile, ok := os.LookupEnv(envKey + "_FILE"); ok {
+		file = envFile
+	}
+	if len(file) > 0 {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
 		}
-		itemId := pathParams[1]
+		return strings.TrimSpace(string(content)), nil
+	}
+	return value, nil
+}
 
-		// set the handler
-		var idx Indexer
-		if request.Method == "GET" {
-			idx = GetItem{}
+// configTenantSecrets reads the credentials of the tenant like configSecrets. The environment variables
+// are named after the tenant, e.g. OCR_PROCESSOR_TENANTS_LIBRARY_DSPACE_PASSWORD, with - in the name
+// replaced by _.
+func configTenantSecrets(tenant *Tenant) error {
+	prefix := envPrefix + "_TENANTS_" + strings.ToUpper(strings.ReplaceAll(tenant.Name, "-", "_")) + "_"
+	secrets := []struct {
+		key   string
+		value **string
+		file  string
+	}{
+		{"dspace_user", &tenant.DSpaceUser, tenant.DSpaceUserFile},
+		{"dspace_password", &tenant.DSpacePassword, tenant.DSpacePasswordFile},
+		{"solr_username", &tenant.SolrUsername, tenant.SolrUsernameFile},
+		{"solr_password", &tenant.SolrPassword, tenant.SolrPasswordFile},
+		{"solr_token", &tenant.SolrToken, tenant.SolrTokenFile},
+	}
+	for _, secret := range secrets {
+		configured := ""
+		if *secret.value != nil {
+			configured = **secret.value
 		}
-		if request.Method == "POST" {
-			idx = AddItem{}
+		value, err := configSecret(prefix+strings.ToUpper(secret.key), secret.file, configured)
+		if err != nil {
+			return fmt.Errorf("unable to read secret file for tenant %s %s: %v", tenant.Name, secret.key, err)
 		}
-		if request.Method == "DELETE" {
-			idx = DeleteItem{}
+		if *secret.value != nil || len(value) > 0 {
+			*secret.value = &value
 		}
+	}
+	return nil
+}
 
-		if idx != nil {
-			err := HandleAction(idx, config, &itemId, logger)
+// configApiKeys returns the API keys with the keys read from their key files. The key of a single API key
+// can also be set with the OCR_PROCESSOR_API_KEY environment variable, which grants all scopes.
+func configApiKeys() ([]ApiKey, error) {
+	var apiKeys []ApiKey
+	if err := configList("api_keys", &apiKeys); err != nil {
+		return nil, errors.New("invalid api_keys configuration: " + err.Error())
+	}
+	for i, apiKey := range apiKeys {
+		if len(apiKey.KeyFile) > 0 {
+			value, err := ioutil.ReadFile(apiKey.KeyFile)
 			if err != nil {
-				handleError(err, response, 500)
-				return
+				return nil, errors.New("unable to read key file for api key " + apiKey.Name + ": " + err.Error())
 			}
-		} else {
-			logger.Println("Missing or invalid processing action.")
-			handleError(errors.New("invalid or missing action"), response, 400)
-			return
+			apiKeys[i].Key = strings.TrimSpace(string(value))
 		}
-		response.WriteHeader(200)
-		return
+	}
+	if key, ok := os.LookupEnv(envPrefix + "_API_KEY"); ok && len(key) > 0 {
+		apiKeys = append(apiKeys, ApiKey{Name: "environment", Key: key, Scopes: []string{"read", "index", "delete"}})
+	}
+	return apiKeys, nil
+}
+
+// logLevel returns the configured log level. The verbose_logging setting of earlier versions is used
+// when log_level is not set.
+func logLevel() string {
+	if level := viper.GetString("log_level"); len(level) > 0 {
+		return level
+	}
+	if viper.GetBool("verbose_logging") {
+		return "debug"
+	}
+	return "info"
+}
 
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write([]byte("The OCR processor service is running."))
+	if err != nil {
+		logger.Error("Unable to write response.", logging.Err(err))
 	}
+	return
 }
 
-func handleError(err error, response http.ResponseWriter, code int) {
-	logger.Println(err.Error())
-	switch err.(type) {
-	case UnProcessableEntity:
-		response.WriteHeader(422)
-	case BadRequest:
-		response.WriteHeader(400)
-	case MethodNotAllowed:
-		response.WriteHeader(405)
-	case NotFound:
-		response.WriteHeader(404)
-	default:
-		response.WriteHeader(code)
+// getLogOutput returns the writer for log entries selected by the log_output setting: stdout, stderr,
+// or file (the default). The returned close function releases the log file.
+func getLogOutput(config *Configuration) (io.Writer, func(), error) {
+	switch strings.ToLower(config.LogOutput) {
+	case "stdout":
+		return os.Stdout, func() {}, nil
+	case "stderr":
+		return os.Stderr, func() {}, nil
+	case "file", "":
+		file, err := getLogFile(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		reopenOnHangup(file)
+		return file, func() { _ = file.Close() }, nil
 	}
+	return nil, nil, errors.New("unknown log output: " + config.LogOutput)
+}
+
+func getLogFile(config *Configuration) (*logging.File, error) {
+	path := filepath.Join(config.LogDir, "ocr_processor.log")
+	return logging.OpenFile(path, logging.FileOptions{
+		MaxSize:    int64(config.LogMaxSize) * 1024 * 1024,
+		Interval:   config.LogRotateInterval,
+		MaxBackups: config.LogMaxBackups,
+		Compress:   config.LogCompress,
+	})
 }
 
-func getLogFile(config *Configuration) (*os.File, error) {
-	path := config.LogDir + "/ocr_processor.log"
-	file, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0775)
-	return file, err
+// reopenOnHangup reopens the log file when the process receives SIGHUP, e.g. after the file
+// has been moved by logrotate.
+func reopenOnHangup(file *logging.File) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := file.Reopen(); err != nil {
+				println("Unable to reopen log file: " + err.Error())
+			}
+		}
+	}()
 }
 
 func main() {
+	audit := flag.Bool("audit", false, "report inconsistencies between the Solr index, the OCR file directory and DSpace, and exit")
+	auditDSpace := flag.Bool("dspace", false, "with -audit, compare the index with the DSpace Items that have IIIF search enabled")
+	auditFix := flag.Bool("fix", false, "with -audit, repair the inconsistencies found")
+	migrateFiles := flag.Bool("migrate-files", false, "move lazy loaded OCR files to the lazy_file_layout, update the index, and exit")
+	checkConfig := flag.Bool("check-config", false, "validate the configuration, report all problems, and exit")
+	tenant := flag.String("tenant", "", "with -audit or -migrate-files, use the configuration of the named tenant")
+	flag.Parse()
+
 	// app configuration
 	config, err := config()
+	if *checkConfig {
+		os.Exit(runCheckConfig(config, err))
+	}
 	if err != nil {
-		println("Server config is missing: " + err.Error())
-		return
+		println("Invalid server config: " + err.Error())
+		os.Exit(1)
 	}
 
 	// set up logging
-	file, err := getLogFile(config)
+	output, closeOutput, err := getLogOutput(config)
 	if err != nil {
-		println("Log file directory not found: " + err.Error())
+		println("Unable to open log output: " + err.Error())
 		return
 	}
-	defer file.Close()
-	logger = log.New(file, "indexer: ", log.LstdFlags)
+	defer closeOutput()
+	level, err := logging.ParseLevel(config.LogLevel)
+	if err != nil {
+		println(err.Error())
+		return
+	}
+	logger = logging.New(output, level)
+
+	tenants, err := validateConfig(config)
+	if err != nil {
+		logger.Error("Invalid configuration.", logging.Err(err))
+		closeOutput()
+		os.Exit(1)
+	}
+	selected := config
+	if len(*tenant) > 0 {
+		selected = nil
+		for _, settings := range tenants {
+			if settings.Tenant == *tenant {
+				selected = settings
+			}
+		}
+		if selected == nil {
+			println("Unknown tenant: " + *tenant)
+			closeOutput()
+			os.Exit(1)
+		}
+	}
+	if *migrateFiles {
+		code := runMigration(selected)
+		closeOutput()
+		os.Exit(code)
+	}
+	if *audit {
+		code := runAudit(selected, AuditOptions{DSpace: *auditDSpace, Fix: *auditFix})
+		closeOutput()
+		os.Exit(code)
+	}
 
 	// set up the server and handler(s)
+	svc, err := newService(config, tenants)
+	if err != nil {
+		logger.Error("Invalid authentication configuration.", logging.Err(err))
+		closeOutput()
+		os.Exit(1)
+	}
+	svc.watch()
+
+	// listen
+	if err := serve(svc, logging.RequestId(logger, metrics.InFlight(svc))); err != nil {
+		logger.Error("Server failed.", logging.Err(err))
+		closeOutput()
+		os.Exit(1)
+	}
+}
+
+// newHandler creates the authenticator and the routes for the configuration and its tenants.
+func newHandler(config *Configuration, tenants []*Configuration) (http.Handler, error) {
+	// set up authentication
+	authenticator, err := auth.New(*config, logger)
+	if err != nil {
+		return nil, err
+	}
 	mux := http.NewServeMux()
-	indexer := indexingHandler(config, logger)
 
 	// define routes
-	mux.Handle("/item/", indexer)
+	router := handleRoutes(mux, config, authenticator)
+	// metrics and the configuration include all tenants
+	router.Handle(http.MethodGet, "/metrics", authenticator.RequireGlobal(auth.ReadScope, metrics.Handler()))
+	router.Handle(http.MethodGet, "/config", authenticator.RequireGlobal(auth.ReadScope,
+		ConfigHandler(config, logger)))
+	mux.Handle("/metrics", router)
+	mux.Handle("/config", router)
 	mux.HandleFunc("/status", statusHandler)
+	mux.Handle("/health/live", LivenessHandler())
+	for _, settings := range tenants {
+		handleRoutes(mux, settings, authenticator)
+	}
+	if len(tenants) > 0 {
+		// requests for unknown tenants
+		mux.Handle(auth.TenantPrefix, NewRouter(logger))
+	}
+	return authenticator.Tenants(tenantPaths, mux), nil
+}
 
-	// listen
-	serverError := http.ListenAndServe(":"+config.HttpPort, mux)
-	if serverError != nil {
-		logger.Fatal(serverError)
+// handleRoutes adds the item, audit, search and readiness routes for the configuration to the mux and
+// returns the router of the item and audit routes. The routes of a tenant are prefixed with /t/{name} and
+// the tenant is added to their log entries.
+func handleRoutes(mux *http.ServeMux, config *Configuration, authenticator *auth.Authenticator) *Router {
+	prefix := ""
+	logger := logger
+	if len(config.Tenant) > 0 {
+		prefix = auth.TenantPrefix + config.Tenant
+		logger = logger.With(logging.F("tenant", config.Tenant))
+	}
+	handle := func(path string, handler http.Handler) {
+		if len(config.Tenant) > 0 {
+			handler = tenantLogging(config.Tenant, handler)
+		}
+		mux.Handle(prefix+path, handler)
+	}
+	router := NewRouter(logger)
+	for _, path := range []string{prefix + ApiPrefix + "/items/{id}", prefix + "/item/{id}"} {
+		router.Handle(http.MethodGet, path, authenticator.Require(auth.ReadScope,
+			ItemHandler(config, logger, GetItem{}, CheckAction)))
+		router.Handle(http.MethodPost, path, authenticator.Require(auth.IndexScope,
+			ItemHandler(config, logger, AddItem{}, IndexAction)))
+		router.Handle(http.MethodDelete, path, authenticator.Require(auth.DeleteScope,
+			ItemHandler(config, logger, DeleteItem{}, DeleteAction)))
+	}
+	router.Handle(http.MethodGet, prefix+ApiPrefix+"/audit", authenticator.Require(auth.ReadScope,
+		AuditHandler(config, logger, false)))
+	router.Handle(http.MethodPost, prefix+ApiPrefix+"/audit", authenticator.Require(auth.IndexScope,
+		authenticator.Require(auth.DeleteScope, AuditHandler(config, logger, true))))
+	handle(ApiPrefix+"/", router)
+	handle("/item/", router)
+	// IIIF Content Search API routes are public so that IIIF viewers can search Items. The urls in their
+	// responses use the scheme forwarded by trusted proxies.
+	handle("/search/", authenticator.ForwardedProto(SearchHandler(config, logger, 1)))
+	handle("/search/v2/", authenticator.ForwardedProto(SearchHandler(config, logger, 2)))
+	handle("/autocomplete/", authenticator.ForwardedProto(AutocompleteHandler(config, logger, 1, prefix+"/search/")))
+	handle("/autocomplete/v2/", authenticator.ForwardedProto(AutocompleteHandler(config, logger, 2,
+		prefix+"/search/v2/")))
+	handle("/health/ready", ReadinessHandler(config, logger))
+	return router
+}
+
+// tenantLogging wraps the handler to add the tenant to the log entries of requests.
+func tenantLogging(tenant string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requestLogger := logging.FromContext(request.Context(), logger).With(logging.F("tenant", tenant))
+		next.ServeHTTP(response, request.WithContext(logging.NewContext(request.Context(), requestLogger)))
+	})
+}
+
+// runCheckConfig writes the problems found when reading and validating the configuration to stdout and
+// returns the exit code: 0 if the configuration is valid, and 1 otherwise. The configuration is nil if the
+// configuration file could not be read.
+func runCheckConfig(config *Configuration, readErr error) int {
+	var problems configErrors
+	problems.check(readErr)
+	if config != nil {
+		_, err := validateConfig(config)
+		problems.check(err)
+	}
+	if len(problems) == 0 {
+		fmt.Println("The configuration is valid.")
+		return 0
+	}
+	fmt.Println("The configuration is invalid:")
+	for _, problem := range problems {
+		fmt.Println("  - " + problem)
+	}
+	return 1
+}
+
+// runAudit writes the audit report to stdout and returns the exit code: 0 if the index is consistent or
+// was repaired, 1 if the audit or a repair failed, and 2 if inconsistencies were found and not repaired.
+func runAudit(config *Configuration, options AuditOptions) int {
+	report, err := Audit(context.Background(), config, options, logger)
+	if err != nil {
+		logger.Error("Audit failed.", logging.Err(err))
+		println("Audit failed: " + err.Error())
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return 1
+	}
+	switch {
+	case report.Repairs != nil && len(report.Repairs.Errors) > 0:
+		return 1
+	case report.Repairs == nil && !report.Consistent():
+		return 2
+	}
+	return 0
+}
+
+// runMigration moves lazy loaded OCR files to the configured layout, writes the result to stdout, and
+// returns the exit code: 0 if all files were migrated, and 1 otherwise.
+func runMigration(config *Configuration) int {
+	result, err := process.MigrateFiles(*config, logger)
+	if err != nil {
+		logger.Error("File migration failed.", logging.Err(err))
+		println("File migration failed: " + err.Error())
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(result); err != nil || len(result.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// serve runs the server until the process receives SIGINT or SIGTERM. The server then stops accepting
+// requests and waits for requests in progress to finish until the shutdown timeout. Items that are still
+// being indexed at the deadline are interrupted and removed from the index, so that they are not left
+// partially indexed, and pending Solr updates are committed before serve returns. If a poll interval
+// is configured, a DSpace poll scheduler runs for the configuration and each tenant while the server is
+// running and is stopped in the same way.
+func serve(svc *service, handler http.Handler) error {
+	config, _ := svc.current()
+	tlsConfig, err := tlsconfig.ServerConfig(*config, logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// item actions run under the base context, so they are interrupted only at the shutdown deadline
+	ctx = WithServerContext(ctx)
+	var active sync.WaitGroup
+	server := &http.Server{
+		Addr:              net.JoinHostPort(config.HttpBindAddress, config.HttpPort),
+		TLSConfig:         tlsConfig,
+		Handler:           tracked(&active, handler),
+		ReadHeaderTimeout: config.HttpReadTimeout,
+		ReadTimeout:       config.HttpReadTimeout,
+		WriteTimeout:      config.HttpWriteTimeout,
+		IdleTimeout:       config.HttpIdleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return ctx
+		},
+	}
+	serverError := make(chan error, 1)
+	go func() {
+		logger.Info("Server listening.", logging.F("address", server.Addr), logging.F("tls", tlsConfig != nil))
+		if tlsConfig != nil {
+			serverError <- server.ListenAndServeTLS("", "")
+			return
+		}
+		serverError <- server.ListenAndServe()
+	}()
+	svc.startPolling(ctx)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(stop)
+	select {
+	case err := <-serverError:
+		return err
+	case sig := <-stop:
+		config, _ = svc.current()
+		logger.Info("Shutting down.", logging.F("signal", sig.String()),
+			logging.F("timeout", config.ShutdownTimeout.String()))
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelShutdown()
+	active.Add(1)
+	go func() {
+		defer active.Done()
+		svc.stopPolling()
+	}()
+	err = server.Shutdown(shutdownCtx)
+	if err == nil && !waitTimeout(&active, time.Until(deadline(shutdownCtx))) {
+		err = errors.New("scheduled indexing in progress")
+	}
+	if err != nil {
+		logger.Warn("Shutdown timeout reached, interrupting requests in progress.", logging.Err(err))
+		cancel()
+		if !waitTimeout(&active, rollbackTimeout) {
+			logger.Error("Requests in progress did not stop.")
+		}
+	}
+	for _, settings := range svc.solrConfigs() {
+		if err := process.CommitSolr(*settings); err != nil {
+			logger.Error("Unable to commit Solr updates.", logging.Err(err), logging.F("tenant", settings.Tenant))
+		}
 	}
-	logger.Println("Server started and listening on port: " + config.HttpPort)
+	logger.Info("Server stopped.")
+	return nil
+}
 
+// tracked wraps the handler to add requests in progress to the wait group.
+func tracked(active *sync.WaitGroup, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		active.Add(1)
+		defer active.Done()
+		next.ServeHTTP(response, request)
+	})
+}
+
+// deadline returns the deadline of the context.
+func deadline(ctx context.Context) time.Time {
+	t, _ := ctx.Deadline()
+	return t
+}
+
+// waitTimeout waits for the wait group and returns false if the timeout is reached first.
+func waitTimeout(wait *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wait.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
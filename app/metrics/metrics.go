@@ -0,0 +1,256 @@
+// Package metrics provides counters, gauges, and histograms exposed in the Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the histogram bucket upper bounds in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is implemented by each metric type to write its samples.
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics []metric
+}{}
+
+func register(m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// Handler returns the http handler that writes all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		registry.Lock()
+		metrics := append([]metric{}, registry.metrics...)
+		registry.Unlock()
+		for _, m := range metrics {
+			m.write(w)
+		}
+	})
+}
+
+// desc holds the name, help text, and label names of a metric.
+type desc struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (d desc) header(w io.Writer, metricType string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, metricType)
+}
+
+// key joins label values into a map key.
+func key(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats the label names and values, with an optional extra label.
+func (d desc) labelPairs(values []string, extra ...string) string {
+	pairs := make([]string, 0, len(values)+1)
+	for i, name := range d.labels {
+		pairs = append(pairs, name+"=\""+escape(values[i])+"\"")
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+"=\""+extra[1]+"\"")
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (d desc) checkLabels(values []string) {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s requires %d label values", d.name, len(d.labels)))
+	}
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// sortedKeys returns the keys of the sample map in a stable order.
+func sortedKeys(samples map[string][]string) []string {
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	desc
+	mutex  sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewCounterVec creates and registers a counter.
+func NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, labels}, values: map[string]float64{}, labels: map[string][]string{}}
+	register(c)
+	return c
+}
+
+// Add increases the counter for the label values.
+func (c *CounterVec) Add(value float64, labels ...string) {
+	c.checkLabels(labels)
+	k := key(labels)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[k] += value
+	c.labels[k] = labels
+}
+
+// Inc increments the counter for the label values.
+func (c *CounterVec) Inc(labels ...string) {
+	c.Add(1, labels...)
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.header(w, "counter")
+	for _, k := range sortedKeys(c.labels) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labelPairs(c.labels[k]), formatFloat(c.values[k]))
+	}
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	desc
+	mutex  sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+// NewGaugeVec creates and registers a gauge.
+func NewGaugeVec(name string, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{desc: desc{name, help, labels}, values: map[string]float64{}, labels: map[string][]string{}}
+	register(g)
+	return g
+}
+
+// Add changes the gauge for the label values by the (possibly negative) value.
+func (g *GaugeVec) Add(value float64, labels ...string) {
+	g.checkLabels(labels)
+	k := key(labels)
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.values[k] += value
+	g.labels[k] = labels
+}
+
+// Inc increments the gauge for the label values.
+func (g *GaugeVec) Inc(labels ...string) {
+	g.Add(1, labels...)
+}
+
+// Dec decrements the gauge for the label values.
+func (g *GaugeVec) Dec(labels ...string) {
+	g.Add(-1, labels...)
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.header(w, "gauge")
+	if len(g.labels) == 0 && len(g.desc.labels) == 0 {
+		fmt.Fprintf(w, "%s 0\n", g.name)
+		return
+	}
+	for _, k := range sortedKeys(g.labels) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labelPairs(g.labels[k]), formatFloat(g.values[k]))
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mutex   sync.Mutex
+	samples map[string]*histogram
+	labels  map[string][]string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates and registers a histogram with the bucket upper bounds.
+func NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name, help, labels}, buckets: buckets, samples: map[string]*histogram{},
+		labels: map[string][]string{}}
+	register(h)
+	return h
+}
+
+// Observe adds the value to the histogram for the label values.
+func (h *HistogramVec) Observe(value float64, labels ...string) {
+	h.checkLabels(labels)
+	k := key(labels)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	sample, ok := h.samples[k]
+	if !ok {
+		sample = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.samples[k] = sample
+		h.labels[k] = labels
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			sample.counts[i]++
+		}
+	}
+	sample.count++
+	sample.sum += value
+}
+
+// ObserveDuration adds the time elapsed since start, in seconds, to the histogram.
+func (h *HistogramVec) ObserveDuration(start time.Time, labels ...string) {
+	h.Observe(time.Since(start).Seconds(), labels...)
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.header(w, "histogram")
+	for _, k := range sortedKeys(h.labels) {
+		sample := h.samples[k]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(h.labels[k], "le", formatFloat(bound)),
+				sample.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelPairs(h.labels[k], "le", "+Inf"), sample.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelPairs(h.labels[k]), formatFloat(sample.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelPairs(h.labels[k]), sample.count)
+	}
+}
@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	counter := NewCounterVec("test_requests_total", "Test requests.", "endpoint", "code")
+	counter.Inc("select", "200")
+	counter.Add(2, "select", "200")
+	histogram := NewHistogramVec("test_duration_seconds", "Test duration.", []float64{0.1, 1}, "endpoint")
+	histogram.Observe(0.5, "select")
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+	expected := []string{
+		"# TYPE test_requests_total counter",
+		`test_requests_total{endpoint="select",code="200"} 3`,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{endpoint="select",le="0.1"} 0`,
+		`test_duration_seconds_bucket{endpoint="select",le="1"} 1`,
+		`test_duration_seconds_bucket{endpoint="select",le="+Inf"} 1`,
+		`test_duration_seconds_sum{endpoint="select"} 0.5`,
+		`test_duration_seconds_count{endpoint="select"} 1`,
+		"ocr_processor_http_requests_in_flight 0",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected metrics output to contain %q", line)
+		}
+	}
+}
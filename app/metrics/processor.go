@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+)
+
+var (
+	// Items counts indexing actions by action (index, delete) and result (success, failure).
+	Items = NewCounterVec("ocr_processor_items_total",
+		"DSpace Items processed by action and result.", "action", "result")
+	// Pages counts OCR pages by detected format.
+	Pages = NewCounterVec("ocr_processor_pages_total",
+		"OCR pages processed by format.", "format")
+	// ConversionSeconds observes the time used to update and convert an OCR page.
+	ConversionSeconds = NewHistogramVec("ocr_processor_page_conversion_seconds",
+		"Time used to update and convert an OCR page by format.", DefaultBuckets, "format")
+	// DSpaceRequestSeconds observes DSpace request latency by endpoint.
+	DSpaceRequestSeconds = NewHistogramVec("ocr_processor_dspace_request_duration_seconds",
+		"DSpace request latency by endpoint.", DefaultBuckets, "endpoint")
+	// DSpaceRequests counts DSpace requests by endpoint and response code.
+	DSpaceRequests = NewCounterVec("ocr_processor_dspace_requests_total",
+		"DSpace requests by endpoint and response code.", "endpoint", "code")
+	// SolrRequestSeconds observes Solr request latency by endpoint.
+	SolrRequestSeconds = NewHistogramVec("ocr_processor_solr_request_duration_seconds",
+		"Solr request latency by endpoint.", DefaultBuckets, "endpoint")
+	// SolrRequests counts Solr requests by endpoint and response code.
+	SolrRequests = NewCounterVec("ocr_processor_solr_requests_total",
+		"Solr requests by endpoint and response code.", "endpoint", "code")
+	// FileBytesWritten counts bytes written to the OCR file directory for lazy indexing.
+	FileBytesWritten = NewCounterVec("ocr_processor_file_bytes_written_total",
+		"Bytes written to the OCR file directory.")
+	// FileBytesSaved counts bytes saved by compressing OCR files for lazy indexing.
+	FileBytesSaved = NewCounterVec("ocr_processor_file_bytes_saved_total",
+		"Bytes saved by compressing files in the OCR file directory.")
+	// InFlightRequests is the number of http requests being handled.
+	InFlightRequests = NewGaugeVec("ocr_processor_http_requests_in_flight",
+		"HTTP requests currently being handled.")
+)
+
+// StatusCode returns the response code label for a request, or "error" if there was no response.
+func StatusCode(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return "error"
+	}
+	return strconv.Itoa(resp.StatusCode)
+}
+
+// InFlight wraps the handler to track the number of requests being handled.
+func InFlight(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		InFlightRequests.Inc()
+		defer InFlightRequests.Dec()
+		next.ServeHTTP(w, r)
+	})
+}
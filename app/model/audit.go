@@ -0,0 +1,46 @@
+package model
+
+// AuditReport lists inconsistencies between DSpace, the Solr index, and the OCR file directory.
+type AuditReport struct {
+	Documents   int  `json:"documents"`
+	Items       int  `json:"items"`
+	Files       int  `json:"files"`
+	DSpaceItems *int `json:"dspace_items,omitempty"`
+	// OrphanDocuments are indexed items that are not in DSpace with IIIF search enabled, or whose
+	// manifest url does not belong to the manifest base.
+	OrphanDocuments []AuditItem `json:"orphan_documents"`
+	// MissingFiles are lazy documents whose OCR file does not exist.
+	MissingFiles []AuditFile `json:"missing_files"`
+	// OrphanFiles are files in the OCR file directory that no document refers to.
+	OrphanFiles []string `json:"orphan_files"`
+	// UnindexedItems are DSpace items with IIIF search enabled that are not indexed.
+	UnindexedItems []string      `json:"unindexed_items"`
+	Repairs        *AuditRepairs `json:"repairs,omitempty"`
+}
+
+// AuditItem is an indexed item found by an audit.
+type AuditItem struct {
+	Id          string `json:"id,omitempty"`
+	ManifestUrl string `json:"manifest_url"`
+	Documents   int    `json:"documents"`
+}
+
+// AuditFile is a lazy document found by an audit.
+type AuditFile struct {
+	SolrId   string `json:"solr_id"`
+	FilePath string `json:"file_path"`
+}
+
+// AuditRepairs counts the repairs made by an audit.
+type AuditRepairs struct {
+	DocumentsDeleted int      `json:"documents_deleted"`
+	ItemsIndexed     int      `json:"items_indexed"`
+	FilesRemoved     int      `json:"files_removed"`
+	Errors           []string `json:"errors,omitempty"`
+}
+
+// Consistent returns true if the audit found no inconsistencies.
+func (report AuditReport) Consistent() bool {
+	return len(report.OrphanDocuments) == 0 && len(report.MissingFiles) == 0 && len(report.OrphanFiles) == 0 &&
+		len(report.UnindexedItems) == 0
+}
@@ -1,18 +1,151 @@
 package model
 
+import (
+	"os"
+	"time"
+)
+
 type Configuration struct {
+	// Tenant is the name of the tenant the configuration applies to, or empty for the top level configuration.
+	Tenant               string
+	Tenants              []Tenant
 	DSpaceHost           string
+	DSpaceUser           string
+	DSpacePassword       string
 	ManifestBase         string
 	Collections          []string
+	PollInterval         time.Duration
+	PollStateFile        string
+	PollConfiguration    string
 	SolrUrl              string
+	SolrUrls             []string
 	SolrCore             string
+	SolrCloud            bool
+	SolrRouteByItem      bool
+	SolrFields           SolrFields
+	MetadataFields       []MetadataField
+	SolrUsername         string
+	SolrPassword         string
+	SolrToken            string
+	SolrCaFile           string
+	SolrClientCert       string
+	SolrClientKey        string
 	ConvertToMiniOcr     bool
 	IndexType            string
 	EscapeUtf8           bool
 	XmlFileLocation      string
+	LazyFileLayout       string
+	LazyStorage          string
+	S3Endpoint           string
+	S3Region             string
+	S3Bucket             string
+	S3Prefix             string
+	S3AccessKey          string
+	S3SecretKey          string
+	S3PathStyle          bool
+	LazyFileCompression  string
+	LazyFileMode         os.FileMode
+	LazyDirMode          os.FileMode
+	LazyFileOwner        string
+	LazyFileGroup        string
 	HttpPort             string
+	HttpBindAddress      string
+	TlsCertFile          string
+	TlsKeyFile           string
+	TlsClientCaFile      string
+	TlsClientAuth        string
+	HttpReadTimeout      time.Duration
+	HttpWriteTimeout     time.Duration
+	HttpIdleTimeout      time.Duration
+	ShutdownTimeout      time.Duration
+	HealthCheckItem      string
 	IpWhitelist          []string
+	TrustedProxies       []string
+	ApiKeys              []ApiKey
 	InputImageResolution int
-	VerboseLogging       bool
+	LogLevel             string
 	LogDir               string
+	LogOutput            string
+	LogMaxSize           int
+	LogRotateInterval    time.Duration
+	LogMaxBackups        int
+	LogCompress          bool
+}
+
+// SolrFields maps the fields written by the processor to Solr schema field names. Optional fields
+// are not added to the Solr document if the field name is empty.
+type SolrFields struct {
+	Id          string `mapstructure:"id"`
+	ManifestUrl string `mapstructure:"manifest_url"`
+	OcrText     string `mapstructure:"ocr_text"`
+	Title       string `mapstructure:"title"`
+	PageLabel   string `mapstructure:"page_label"`
+	CanvasId    string `mapstructure:"canvas_id"`
+	// Provenance fields record when, from which bitstream, and how the page was indexed.
+	IndexedAt        string `mapstructure:"indexed_at"`
+	SourceUrl        string `mapstructure:"source_url"`
+	SourceChecksum   string `mapstructure:"source_checksum"`
+	Position         string `mapstructure:"position"`
+	SourceFormat     string `mapstructure:"source_format"`
+	Conversion       string `mapstructure:"conversion"`
+	EscapeUtf8       string `mapstructure:"escape_utf8"`
+	ProcessorVersion string `mapstructure:"processor_version"`
+}
+
+// MetadataField maps a IIIF manifest metadata label to a Solr field.
+type MetadataField struct {
+	Label string `mapstructure:"label"`
+	Field string `mapstructure:"field"`
+}
+
+// ApiKey is a credential for the http API and the scopes (read, index, delete) it grants. The key
+// is read from KeyFile when it is set.
+type ApiKey struct {
+	Name    string   `mapstructure:"name"`
+	Key     string   `mapstructure:"key"`
+	KeyFile string   `mapstructure:"key_file"`
+	Scopes  []string `mapstructure:"scopes"`
+	// Tenant restricts the key to the named tenant. Requests without a tenant prefix that use the key are
+	// handled by the tenant.
+	Tenant string `mapstructure:"tenant"`
+}
+
+// redacted replaces credentials in Redacted configurations.
+const redacted = "[redacted]"
+
+// Redacted returns a copy of the configuration with passwords, tokens, and keys replaced, e.g. to show
+// the configuration in a response.
+func (c Configuration) Redacted() Configuration {
+	for _, value := range []*string{&c.DSpacePassword, &c.SolrPassword, &c.SolrToken, &c.S3AccessKey, &c.S3SecretKey} {
+		redact(value)
+	}
+	if c.ApiKeys != nil {
+		keys := make([]ApiKey, len(c.ApiKeys))
+		for i, key := range c.ApiKeys {
+			redact(&key.Key)
+			keys[i] = key
+		}
+		c.ApiKeys = keys
+	}
+	if c.Tenants != nil {
+		tenants := make([]Tenant, len(c.Tenants))
+		for i, tenant := range c.Tenants {
+			for _, value := range []**string{&tenant.DSpacePassword, &tenant.SolrPassword, &tenant.SolrToken} {
+				if *value != nil {
+					secret := **value
+					redact(&secret)
+					*value = &secret
+				}
+			}
+			tenants[i] = tenant
+		}
+		c.Tenants = tenants
+	}
+	return c
+}
+
+func redact(value *string) {
+	if len(*value) > 0 {
+		*value = redacted
+	}
 }
@@ -0,0 +1,69 @@
+package model
+
+// Bitstream is the DSpace REST API representation of a bitstream, limited to the fields used here.
+type Bitstream struct {
+	Id       string `json:"uuid"`
+	Name     string `json:"name"`
+	CheckSum struct {
+		Algorithm string `json:"checkSumAlgorithm"`
+		Value     string `json:"value"`
+	} `json:"checkSum"`
+}
+
+// DSpaceItem is the DSpace REST API representation of an item, limited to the fields used here.
+type DSpaceItem struct {
+	Id           string                           `json:"uuid"`
+	InArchive    bool                             `json:"inArchive"`
+	Discoverable bool                             `json:"discoverable"`
+	Withdrawn    bool                             `json:"withdrawn"`
+	LastModified string                           `json:"lastModified"`
+	Metadata     map[string][]DSpaceMetadataValue `json:"metadata"`
+}
+
+// DSpaceMetadataValue is a value of a DSpace metadata field.
+type DSpaceMetadataValue struct {
+	Value string `json:"value"`
+}
+
+// MetadataValue returns the first value of the metadata field or an empty string.
+func (item DSpaceItem) MetadataValue(field string) string {
+	if values := item.Metadata[field]; len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+// SearchEnabled returns true if the item is archived, not withdrawn, and has IIIF and IIIF search enabled.
+func (item DSpaceItem) SearchEnabled() bool {
+	return item.InArchive && !item.Withdrawn && item.MetadataValue("dspace.iiif.enabled") == "true" &&
+		item.MetadataValue("iiif.search.enabled") == "true"
+}
+
+// DiscoveryResponse is a page of DSpace discovery search results.
+type DiscoveryResponse struct {
+	Embedded struct {
+		SearchResult struct {
+			Embedded struct {
+				Objects []struct {
+					Embedded struct {
+						IndexableObject DSpaceItem `json:"indexableObject"`
+					} `json:"_embedded"`
+				} `json:"objects"`
+			} `json:"_embedded"`
+			Page struct {
+				Number     int `json:"number"`
+				TotalPages int `json:"totalPages"`
+			} `json:"page"`
+		} `json:"searchResult"`
+	} `json:"_embedded"`
+}
+
+// Items returns the items in the search results.
+func (response DiscoveryResponse) Items() []DSpaceItem {
+	objects := response.Embedded.SearchResult.Embedded.Objects
+	items := make([]DSpaceItem, 0, len(objects))
+	for _, object := range objects {
+		items = append(items, object.Embedded.IndexableObject)
+	}
+	return items
+}
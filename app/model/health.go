@@ -0,0 +1,14 @@
+package model
+
+// HealthStatus is the response of the health check endpoints.
+type HealthStatus struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks,omitempty"`
+}
+
+// HealthResult is the result of checking a single dependency.
+type HealthResult struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
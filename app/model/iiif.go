@@ -1,14 +1,21 @@
 package model
 
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
 type Manifest struct {
 	Context     string     `json:"@context"`
 	Type        string     `json:"@type"`
 	Id          string     `json:"@id"`
 	Label       string     `json:"label"`
-	Metadata    []Metadata `json:"-"`
+	Metadata    []Metadata `json:"metadata"`
 	Service     Service    `json:"-"`
 	SeeAlso     SeeAlso    `json:"SeeAlso,omitempty"`
-	Sequences   []Sequence `json:"-"`
+	Sequences   []Sequence `json:"sequences"`
 	Thumbnail   Thumbnail  `json:"-"`
 	ViewingHint string     `json:"-"`
 	Related     Related    `json:"-"`
@@ -18,6 +25,94 @@ type Metadata struct {
 	Value []string `json:"value"`
 }
 
+// UnmarshalJSON accepts metadata labels and values that are a string, a list of strings, or a list
+// of language-tagged values.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Label json.RawMessage `json:"label"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	m.Label = strings.Join(metadataValues(raw.Label), " ")
+	m.Value = metadataValues(raw.Value)
+	return nil
+}
+
+// manifestFields has the fields of Manifest without its UnmarshalJSON method.
+type manifestFields Manifest
+
+// UnmarshalJSON accepts a manifest label that is a string, a list of strings, or a language map.
+func (manifest *Manifest) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		manifestFields
+		Label json.RawMessage `json:"label"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*manifest = Manifest(raw.manifestFields)
+	manifest.Label = strings.Join(metadataValues(raw.Label), " ")
+	return nil
+}
+
+// Values returns the values of all metadata entries with the label, ignoring case.
+func (manifest Manifest) Values(label string) []string {
+	values := make([]string, 0)
+	for _, entry := range manifest.Metadata {
+		if strings.EqualFold(entry.Label, label) {
+			values = append(values, entry.Value...)
+		}
+	}
+	return values
+}
+
+// Canvas returns the canvas at the position in the first sequence or nil if there is no such canvas.
+func (manifest Manifest) Canvas(position int) *Canvas {
+	if len(manifest.Sequences) == 0 || position < 0 || position >= len(manifest.Sequences[0].Canvases) {
+		return nil
+	}
+	return &manifest.Sequences[0].Canvases[position]
+}
+
+func metadataValues(raw json.RawMessage) []string {
+	values := make([]string, 0)
+	if len(raw) == 0 {
+		return values
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		return append(values, str)
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, item := range list {
+			values = append(values, metadataValues(item)...)
+		}
+		return values
+	}
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil {
+		return values
+	}
+	if value, ok := object["@value"]; ok {
+		return append(values, metadataValues(value)...)
+	}
+	// a language map has the values of each language
+	languages := make([]string, 0, len(object))
+	for language := range object {
+		if !strings.HasPrefix(language, "@") {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	for _, language := range languages {
+		values = append(values, metadataValues(object[language])...)
+	}
+	return values
+}
+
 type Service struct {
 	Context  string `json:"@context"`
 	Id       string `json:"@id"`
@@ -37,14 +132,94 @@ type Sequence struct {
 	Canvases []Canvas `json:"canvases"`
 }
 
+// UnmarshalJSON keeps the position of canvases that cannot be read, so that OCR pages are mapped to
+// the canvases that follow them. Such canvases have no dimensions.
+func (sequence *Sequence) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Id       string            `json:"@id"`
+		Type     string            `json:"@type"`
+		Canvases []json.RawMessage `json:"canvases"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	sequence.Id, sequence.Type = raw.Id, raw.Type
+	sequence.Canvases = make([]Canvas, len(raw.Canvases))
+	for i, canvas := range raw.Canvases {
+		if err := json.Unmarshal(canvas, &sequence.Canvases[i]); err != nil {
+			sequence.Canvases[i] = Canvas{}
+		}
+	}
+	return nil
+}
+
 type Canvas struct {
 	Id        string    `json:"@id"`
 	Type      string    `json:"@type"`
 	Label     string    `json:"label"`
 	Thumbnail Thumbnail `json:"thumbnail"`
 	Images    []Image   `json:"images"`
-	Width     int       `json:"width,int"`
-	Height    int       `json:"height,int"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+}
+
+// canvasFields has the fields of Canvas without its UnmarshalJSON method.
+type canvasFields Canvas
+
+// UnmarshalJSON accepts a label that is a string, a list of strings, or a language map, dimensions
+// that are numbers or strings, and a thumbnail that is a url, an object, or a list of objects.
+func (canvas *Canvas) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		canvasFields
+		Label     json.RawMessage `json:"label"`
+		Thumbnail json.RawMessage `json:"thumbnail"`
+		Width     json.RawMessage `json:"width"`
+		Height    json.RawMessage `json:"height"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*canvas = Canvas(raw.canvasFields)
+	canvas.Label = strings.Join(metadataValues(raw.Label), " ")
+	canvas.Thumbnail = thumbnail(raw.Thumbnail)
+	canvas.Width = dimension(raw.Width)
+	canvas.Height = dimension(raw.Height)
+	return nil
+}
+
+// dimension returns the canvas dimension, which is a number or a string, or 0 if it is not a number.
+func dimension(raw json.RawMessage) int {
+	var number float64
+	if err := json.Unmarshal(raw, &number); err == nil {
+		return int(number)
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if number, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+			return int(number)
+		}
+	}
+	return 0
+}
+
+// thumbnail returns the first thumbnail, which is a url, an object, or a list of either.
+func thumbnail(raw json.RawMessage) Thumbnail {
+	var id string
+	if err := json.Unmarshal(raw, &id); err == nil {
+		return Thumbnail{Id: id}
+	}
+	var list []json.RawMessage
+	if err := json.Unmarshal(raw, &list); err == nil {
+		if len(list) == 0 {
+			return Thumbnail{}
+		}
+		return thumbnail(list[0])
+	}
+	var result Thumbnail
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return Thumbnail{}
+	}
+	return result
 }
 
 type Thumbnail struct {
@@ -0,0 +1,75 @@
+package model
+
+// ItemResult is the outcome of an indexing action for a DSpace Item.
+type ItemResult struct {
+	PagesIndexed int
+	PagesSkipped int
+	PagesRemoved int
+	// FileBytes and FileBytesSaved are the size of the OCR files written for lazy indexing, and the
+	// bytes saved by compression.
+	FileBytes      int64
+	FileBytesSaved int64
+	// Skipped are the file names of unchanged pages that were not processed again.
+	Skipped  []string
+	Warnings []PageWarning
+	Index    *IndexStatus
+}
+
+// PageWarning describes an OCR file that was skipped or needs attention. Warnings about the Item have
+// no file name.
+type PageWarning struct {
+	FileName string `json:"file_name,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ItemResponse is the JSON body of item API responses.
+type ItemResponse struct {
+	Id             string         `json:"id"`
+	Action         string         `json:"action"`
+	Status         string         `json:"status"`
+	PagesIndexed   int            `json:"pages_indexed,omitempty"`
+	PagesSkipped   int            `json:"pages_skipped,omitempty"`
+	PagesRemoved   int            `json:"pages_removed,omitempty"`
+	FileBytes      int64          `json:"file_bytes,omitempty"`
+	FileBytesSaved int64          `json:"file_bytes_saved,omitempty"`
+	Skipped        []string       `json:"skipped,omitempty"`
+	Warnings       []PageWarning  `json:"warnings,omitempty"`
+	Index          *IndexStatus   `json:"index,omitempty"`
+	Error          *ErrorResponse `json:"error,omitempty"`
+}
+
+// ErrorResponse describes a failed request. The code is derived from the error type, e.g. not_found.
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// StatusResponse is the JSON body of API responses that are not about an Item, e.g. for unknown routes.
+type StatusResponse struct {
+	Status string         `json:"status"`
+	Error  *ErrorResponse `json:"error,omitempty"`
+}
+
+// IndexStatus describes the Solr documents indexed for a DSpace Item.
+type IndexStatus struct {
+	Pages       int           `json:"pages"`
+	DSpacePages *int          `json:"dspace_pages,omitempty"`
+	Stale       *bool         `json:"stale,omitempty"`
+	LastIndexed string        `json:"last_indexed,omitempty"`
+	Documents   []IndexedPage `json:"documents"`
+}
+
+// IndexedPage describes the Solr document for an OCR page. FileExists is set for lazy documents only.
+type IndexedPage struct {
+	SolrId           string `json:"solr_id"`
+	PageId           string `json:"page_id"`
+	IndexType        string `json:"index_type"`
+	FilePath         string `json:"file_path,omitempty"`
+	FileExists       *bool  `json:"file_exists,omitempty"`
+	IndexedAt        string `json:"indexed_at,omitempty"`
+	SourceUrl        string `json:"source_url,omitempty"`
+	SourceChecksum   string `json:"source_checksum,omitempty"`
+	Format           string `json:"format,omitempty"`
+	Conversion       string `json:"conversion,omitempty"`
+	ProcessorVersion string `json:"processor_version,omitempty"`
+}
@@ -0,0 +1,21 @@
+package model
+
+// OcrPage identifies an OCR file of a DSpace Item and its position in the processing order.
+type OcrPage struct {
+	Uuid     string
+	FileName string
+	Position int
+	Format   string
+	Manifest *Manifest
+	// SourceUrl and Checksum identify the DSpace bitstream of the OCR file.
+	SourceUrl string
+	Checksum  string
+	// FileSize is set to the size of the lazy loaded OCR file when the page is written.
+	FileSize *FileSize
+}
+
+// FileSize is the size of an OCR file before and after compression.
+type FileSize struct {
+	Original int64
+	Written  int64
+}
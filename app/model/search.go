@@ -0,0 +1,152 @@
+package model
+
+// SolrHighlightResponse is a Solr select response with solr-ocrhighlighting results.
+type SolrHighlightResponse struct {
+	Response struct {
+		NumFound int       `json:"numFound"`
+		Docs     []SolrDoc `json:"docs"`
+	} `json:"response"`
+	OcrHighlighting map[string]map[string]OcrHighlights `json:"ocrHighlighting"`
+	FacetCounts     struct {
+		FacetFields map[string][]interface{} `json:"facet_fields"`
+	} `json:"facet_counts"`
+}
+
+// OcrHighlights are the highlighted snippets for an OCR field of a document.
+type OcrHighlights struct {
+	Snippets []OcrSnippet `json:"snippets"`
+	NumTotal int          `json:"numTotal"`
+}
+
+// OcrSnippet is a highlighted snippet returned by the solr-ocrhighlighting plugin.
+type OcrSnippet struct {
+	Text       string           `json:"text"`
+	Score      float64          `json:"score"`
+	Pages      []OcrPageRef     `json:"pages"`
+	Regions    []OcrRegion      `json:"regions"`
+	Highlights [][]OcrHighlight `json:"highlights"`
+}
+
+// OcrPageRef is a page referenced by a snippet. The id is the OCR page identifier (e.g. Page.0).
+type OcrPageRef struct {
+	Id     string  `json:"id"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// OcrRegion is a region of a snippet on a page.
+type OcrRegion struct {
+	Ulx     float64 `json:"ulx"`
+	Uly     float64 `json:"uly"`
+	Lrx     float64 `json:"lrx"`
+	Lry     float64 `json:"lry"`
+	Text    string  `json:"text"`
+	PageIdx int     `json:"pageIdx"`
+}
+
+// OcrHighlight is the location of a highlighted term. The coordinates are relative to the page.
+type OcrHighlight struct {
+	Text            string  `json:"text"`
+	Ulx             float64 `json:"ulx"`
+	Uly             float64 `json:"uly"`
+	Lrx             float64 `json:"lrx"`
+	Lry             float64 `json:"lry"`
+	ParentRegionIdx int     `json:"parentRegionIdx"`
+}
+
+// TermCount is an indexed term and the number of documents that contain it.
+type TermCount struct {
+	Term  string
+	Count int
+}
+
+// SearchAnnotationList is the IIIF Content Search 1.0 response.
+type SearchAnnotationList struct {
+	Context   []string           `json:"@context"`
+	Id        string             `json:"@id"`
+	Type      string             `json:"@type"`
+	Within    SearchLayer        `json:"within"`
+	Resources []SearchAnnotation `json:"resources"`
+	Hits      []SearchHit        `json:"hits"`
+}
+
+// SearchLayer describes the total number of results for IIIF Content Search 1.0.
+type SearchLayer struct {
+	Type  string `json:"@type"`
+	Total int    `json:"total"`
+}
+
+// SearchAnnotation is a IIIF Content Search 1.0 annotation for a highlighted term.
+type SearchAnnotation struct {
+	Id         string         `json:"@id"`
+	Type       string         `json:"@type"`
+	Motivation string         `json:"motivation"`
+	Resource   SearchResource `json:"resource"`
+	On         string         `json:"on"`
+}
+
+// SearchResource is the text of a IIIF Content Search 1.0 annotation.
+type SearchResource struct {
+	Type  string `json:"@type"`
+	Chars string `json:"chars"`
+}
+
+// SearchHit groups the annotations for a IIIF Content Search 1.0 match.
+type SearchHit struct {
+	Type        string   `json:"@type"`
+	Annotations []string `json:"annotations"`
+	Match       string   `json:"match"`
+}
+
+// SearchAnnotationPage is the IIIF Content Search 2.0 response.
+type SearchAnnotationPage struct {
+	Context string              `json:"@context"`
+	Id      string              `json:"id"`
+	Type    string              `json:"type"`
+	Items   []SearchAnnotation2 `json:"items"`
+}
+
+// SearchAnnotation2 is a IIIF Content Search 2.0 annotation for a highlighted term.
+type SearchAnnotation2 struct {
+	Id         string      `json:"id"`
+	Type       string      `json:"type"`
+	Motivation string      `json:"motivation"`
+	Body       TextualBody `json:"body"`
+	Target     string      `json:"target"`
+}
+
+// TextualBody is the body of a IIIF Content Search 2.0 annotation.
+type TextualBody struct {
+	Type   string `json:"type"`
+	Value  string `json:"value"`
+	Format string `json:"format"`
+}
+
+// TermList is the IIIF Content Search 1.0 autocomplete response.
+type TermList struct {
+	Context string `json:"@context"`
+	Id      string `json:"@id"`
+	Type    string `json:"@type"`
+	Terms   []Term `json:"terms"`
+}
+
+// Term is a IIIF Content Search 1.0 autocomplete term.
+type Term struct {
+	Match string `json:"match"`
+	Url   string `json:"url"`
+	Count int    `json:"count"`
+}
+
+// TermPage is the IIIF Content Search 2.0 autocomplete response.
+type TermPage struct {
+	Context string  `json:"@context"`
+	Id      string  `json:"id"`
+	Type    string  `json:"type"`
+	Items   []Term2 `json:"items"`
+}
+
+// Term2 is a IIIF Content Search 2.0 autocomplete term.
+type Term2 struct {
+	Value string `json:"value"`
+	Total int    `json:"total"`
+}
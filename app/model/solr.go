@@ -19,24 +19,50 @@ type SolrResponse struct {
 		QTime  int `json:"QTime"`
 	} `json:"responseHeader"`
 	Response struct {
-		NumFound      int    `json:"numFound"`
-		Start         int    `json:"start"`
-		NumFoundExact bool   `json:"numFoundExact"`
-		Docs          []Docs `json:"docs"`
+		NumFound      int       `json:"numFound"`
+		Start         int       `json:"start"`
+		NumFoundExact bool      `json:"numFoundExact"`
+		Docs          []SolrDoc `json:"docs"`
 	} `json:"response"`
+	NextCursorMark string `json:"nextCursorMark"`
 }
 
-type Docs struct {
-	ManifestUrl string `json:"manifest_url,omitempty"`
-	OcrText     string `json:"ocr_text,omitempty"`
+// SolrDoc is a Solr document keyed by the field names in the Solr schema.
+type SolrDoc map[string]interface{}
+
+// String returns the value of a single-valued string field or an empty string.
+func (doc SolrDoc) String(field string) string {
+	switch value := doc[field].(type) {
+	case string:
+		return value
+	case []interface{}:
+		if len(value) > 0 {
+			if str, ok := value[0].(string); ok {
+				return str
+			}
+		}
+	}
+	return ""
 }
 
-type SolrCreatePost struct {
-	Id          string `json:"id"`
-	ManifestUrl string `json:"manifest_url"`
-	OcrText     string `json:"ocr_text"`
+// Int returns the value of a single-valued numeric field, and false if the field has no numeric value.
+func (doc SolrDoc) Int(field string) (int, bool) {
+	switch value := doc[field].(type) {
+	case float64:
+		return int(value), true
+	case []interface{}:
+		if len(value) > 0 {
+			if number, ok := value[0].(float64); ok {
+				return int(number), true
+			}
+		}
+	}
+	return 0, false
 }
 
+// SolrCreatePost is the Solr document created for an OCR page.
+type SolrCreatePost map[string]interface{}
+
 type SolrDeletePost struct {
 	Delete Delete `json:"delete"`
 }
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Tenant is a DSpace repository served by the processor in addition to the top level configuration.
+// The tenant's routes are prefixed with /t/{name}. Settings that are not set are inherited from the
+// top level configuration, except for credentials: the DSpace and Solr credentials are only inherited
+// if the tenant uses the same DSpace host and Solr URLs. Credentials can be read from files named by
+// the settings with the _file suffix.
+type Tenant struct {
+	Name               string   `mapstructure:"name"`
+	DSpaceHost         *string  `mapstructure:"dspace_host"`
+	DSpaceUser         *string  `mapstructure:"dspace_user"`
+	DSpaceUserFile     string   `mapstructure:"dspace_user_file"`
+	DSpacePassword     *string  `mapstructure:"dspace_password"`
+	DSpacePasswordFile string   `mapstructure:"dspace_password_file"`
+	ManifestBase       *string  `mapstructure:"manifest_base"`
+	Collections        []string `mapstructure:"collections"`
+	SolrUrl            *string  `mapstructure:"solr_url"`
+	SolrUrls           []string `mapstructure:"solr_urls"`
+	SolrCore           *string  `mapstructure:"solr_core"`
+	SolrUsername       *string  `mapstructure:"solr_username"`
+	SolrUsernameFile   string   `mapstructure:"solr_username_file"`
+	SolrPassword       *string  `mapstructure:"solr_password"`
+	SolrPasswordFile   string   `mapstructure:"solr_password_file"`
+	SolrToken          *string  `mapstructure:"solr_token"`
+	SolrTokenFile      string   `mapstructure:"solr_token_file"`
+	SolrClientCert     *string  `mapstructure:"solr_client_cert"`
+	SolrClientKey      *string  `mapstructure:"solr_client_key"`
+	IndexType          *string  `mapstructure:"index_type"`
+	ConvertToMiniOcr   *bool    `mapstructure:"miniocr_conversion"`
+	EscapeUtf8         *bool    `mapstructure:"escape_utf8"`
+	XmlFileLocation    *string  `mapstructure:"xml_file_location"`
+	S3Prefix           *string  `mapstructure:"s3_prefix"`
+	HealthCheckItem    *string  `mapstructure:"health_check_item"`
+	PollStateFile      *string  `mapstructure:"poll_state_file"`
+}
+
+// Apply returns the configuration of the tenant: the top level configuration with the tenant's settings.
+// Solr URLs set by the tenant replace both solr_url and solr_urls of the top level configuration. The poll
+// state file defaults to the top level file with the tenant name added, e.g. poll_state.library.json.
+func (t Tenant) Apply(config Configuration) Configuration {
+	config.Tenant = t.Name
+	config.Tenants = nil
+	if t.DSpaceHost != nil && *t.DSpaceHost != config.DSpaceHost {
+		config.DSpaceUser = ""
+		config.DSpacePassword = ""
+	}
+	setString(&config.DSpaceHost, t.DSpaceHost)
+	setString(&config.DSpaceUser, t.DSpaceUser)
+	setString(&config.DSpacePassword, t.DSpacePassword)
+	setString(&config.ManifestBase, t.ManifestBase)
+	if t.Collections != nil {
+		config.Collections = t.Collections
+	}
+	if t.SolrUrl != nil || t.SolrUrls != nil {
+		if !sameStrings(t.SolrUrls, config.SolrUrls) || (t.SolrUrl != nil && *t.SolrUrl != config.SolrUrl) {
+			config.SolrUsername = ""
+			config.SolrPassword = ""
+			config.SolrToken = ""
+			config.SolrClientCert = ""
+			config.SolrClientKey = ""
+		}
+		config.SolrUrl = ""
+		config.SolrUrls = t.SolrUrls
+		setString(&config.SolrUrl, t.SolrUrl)
+	}
+	setString(&config.SolrCore, t.SolrCore)
+	setString(&config.SolrUsername, t.SolrUsername)
+	setString(&config.SolrPassword, t.SolrPassword)
+	setString(&config.SolrToken, t.SolrToken)
+	setString(&config.SolrClientCert, t.SolrClientCert)
+	setString(&config.SolrClientKey, t.SolrClientKey)
+	setString(&config.IndexType, t.IndexType)
+	setBool(&config.ConvertToMiniOcr, t.ConvertToMiniOcr)
+	setBool(&config.EscapeUtf8, t.EscapeUtf8)
+	setString(&config.XmlFileLocation, t.XmlFileLocation)
+	setString(&config.S3Prefix, t.S3Prefix)
+	setString(&config.HealthCheckItem, t.HealthCheckItem)
+	if t.PollStateFile != nil {
+		config.PollStateFile = *t.PollStateFile
+	} else if len(config.PollStateFile) > 0 {
+		ext := filepath.Ext(config.PollStateFile)
+		config.PollStateFile = strings.TrimSuffix(config.PollStateFile, ext) + "." + t.Name + ext
+	}
+	return config
+}
+
+func sameStrings(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func setString(value *string, override *string) {
+	if override != nil {
+		*value = *override
+	}
+}
+
+func setBool(value *bool, override *bool) {
+	if override != nil {
+		*value = *override
+	}
+}
@@ -4,33 +4,39 @@ import (
 	"bytes"
 	"encoding/xml"
 	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	"github.com/mspalti/ocrprocessor/model"
 	"io"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func (processor AltoProcessor) ProcessOcr(uuid *string, fileName string, alto *[]byte, position int,
-	manifestId string, settings model.Configuration, log *log.Logger) error {
-	updatedOcr, err := updateAlto(alto, position, settings)
+func (processor AltoProcessor) ProcessOcr(page model.OcrPage, alto *[]byte, settings model.Configuration,
+	log *logging.Logger) error {
+	start := time.Now()
+	updatedOcr, err := updateAlto(alto, page.Position, settings)
 	if err != nil {
 		return err
 	}
+	log.Debug("Updated the input ALTO file.")
 	if settings.ConvertToMiniOcr {
-		updatedOcr, err = convertToMiniOcr(updatedOcr, position, settings)
+		updatedOcr, err = convertToMiniOcr(updatedOcr, page.Position, settings)
 		if err != nil {
 			return err
 		}
+		log.Debug("Converted ALTO file to MiniOcr.")
 	}
-	if settings.IndexType == "lazy" {
-		err = PostToSolrLazyLoad(uuid, fileName, updatedOcr, manifestId, settings, log)
+	metrics.ConversionSeconds.ObserveDuration(start, AltoFormat.String())
+	if settings.IndexType == LazyIndex {
+		err = PostToSolrLazyLoad(page, updatedOcr, settings, log)
 		if err != nil {
 			return errors.New("ALTO indexing failed: " + err.Error())
 		}
 	} else {
-		err = PostToSolr(uuid, fileName, updatedOcr, manifestId, settings, log)
+		err = PostToSolr(page, updatedOcr, settings, log)
 		if err != nil {
 			return errors.New("ALTO indexing failed: " + err.Error())
 		}
@@ -43,7 +49,7 @@ func (processor AltoProcessor) ProcessOcr(uuid *string, fileName string, alto *[
 func updateAlto(alto *[]byte, position int, settings model.Configuration) (*string, error) {
 
 	// There is no need to update when full indexing or no character conversion is requested.
-	if settings.IndexType != "lazy" && !settings.EscapeUtf8 {
+	if settings.IndexType != LazyIndex && !settings.EscapeUtf8 {
 		out := string(*alto)
 		return &out, nil
 	}
@@ -71,8 +77,7 @@ func updateAlto(alto *[]byte, position int, settings model.Configuration) (*stri
 			break
 		}
 		if err != nil {
-			log.Printf("error getting token: %t\n", err)
-			return nil, err
+			return nil, errors.New("error getting token: " + err.Error())
 		}
 
 		switch t := token.(type) {
@@ -130,7 +135,7 @@ func updateAlto(alto *[]byte, position int, settings model.Configuration) (*stri
 
 			if t.Name.Local == "String" {
 				modified := false
-				if settings.EscapeUtf8 && settings.IndexType == "lazy" {
+				if settings.EscapeUtf8 && settings.IndexType == LazyIndex {
 					pos := getPosition(t, "CONTENT")
 					t.Attr[pos].Value = ToXmlCodePoint(t.Attr[pos].Value)
 					modified = true
@@ -167,14 +172,11 @@ func updateAlto(alto *[]byte, position int, settings model.Configuration) (*stri
 	}
 
 	if err := encoder.Flush(); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	out := buffer.String()
 	updated := fixResponse(&out, settings)
-	if settings.VerboseLogging {
-		log.Println("Updated the input ALTO file.")
-	}
 	return updated, nil
 
 }
@@ -283,7 +285,7 @@ func convertToMiniOcr(original *string, position int, settings model.Configurati
 	lineElements := make([]model.L, 0)
 	wordElements := make([]model.W, 0)
 
-	escape := settings.EscapeUtf8 && settings.IndexType == "lazy"
+	escape := settings.EscapeUtf8 && settings.IndexType == LazyIndex
 
 	for {
 		token, err := decoder.Token()
@@ -373,13 +375,10 @@ func convertToMiniOcr(original *string, position int, settings model.Configurati
 		return nil, err
 	}
 	out := string(marshalledXml)
-	if settings.IndexType == "full" {
+	if settings.IndexType == FullIndex {
 		// use single quotes to submit the XML in solr post
 		out = strings.ReplaceAll(out, "\"", "'")
 	}
-	if settings.VerboseLogging {
-		log.Println("Converted ALTO file to MiniOcr.")
-	}
 	return &out, nil
 
 }
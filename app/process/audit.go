@@ -0,0 +1,103 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/url"
+	"strings"
+)
+
+// IndexedDocument is a page document found by ScanDocuments. FilePath is the lazy loaded OCR file, or
+// empty if the document holds OCR content. Escaped is set if the file is XML-encoded ({ascii} suffix).
+type IndexedDocument struct {
+	SolrId      string
+	ManifestUrl string
+	FilePath    string
+	Escaped     bool
+}
+
+// ScanDocuments calls visit for every document of the configured manifest base in the index, requesting
+// solrPageSize documents at a time with a cursor. Documents of other repositories in a shared index are
+// not visited.
+func ScanDocuments(settings model.Configuration, visit func(doc IndexedDocument) error) error {
+	fields := solrFields(settings)
+	fl := url.QueryEscape(strings.Join([]string{fields.Id, fields.ManifestUrl, fields.OcrText}, ","))
+	fq := url.QueryEscape(fmt.Sprintf("{!prefix f=%s}%s", fields.ManifestUrl, manifestPrefix(settings)))
+	cursor := "*"
+	for {
+		query := fmt.Sprintf("select?fl=%s&q=*:*&fq=%s&sort=%s&rows=%d&cursorMark=%s", fl, fq,
+			url.QueryEscape(fields.Id+" asc"), solrPageSize, url.QueryEscape(cursor))
+		resp, err := solrRequest(settings, "GET", query, nil)
+		if err != nil {
+			return errors.New("could not query solr: " + err.Error())
+		}
+		solrResponse := model.SolrResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&solrResponse)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, doc := range solrResponse.Response.Docs {
+			document := IndexedDocument{SolrId: doc.String(fields.Id), ManifestUrl: doc.String(fields.ManifestUrl)}
+			if path := doc.String(fields.OcrText); isFilePath(path) {
+				document.FilePath = strings.Replace(path, "{ascii}", "", 1)
+				document.Escaped = document.FilePath != path
+			}
+			if err := visit(document); err != nil {
+				return err
+			}
+		}
+		if len(solrResponse.NextCursorMark) == 0 || solrResponse.NextCursorMark == cursor {
+			return nil
+		}
+		cursor = solrResponse.NextCursorMark
+	}
+}
+
+// ManifestItem returns the item uuid of a manifest url, and false if the url is not a manifest of
+// the configured manifest base.
+func ManifestItem(settings model.Configuration, manifestUrl string) (string, bool) {
+	prefix := manifestPrefix(settings)
+	suffix := "/manifest"
+	if !strings.HasPrefix(manifestUrl, prefix) || !strings.HasSuffix(manifestUrl, suffix) {
+		return "", false
+	}
+	uuid := manifestUrl[len(prefix) : len(manifestUrl)-len(suffix)]
+	return uuid, len(uuid) > 0 && !strings.Contains(uuid, "/")
+}
+
+// manifestPrefix returns the start of the manifest urls of the configured manifest base, which is the
+// IIIF endpoint with a trailing slash.
+func manifestPrefix(settings model.Configuration) string {
+	return strings.TrimSuffix(getDSpaceApiEndpoint(settings.ManifestBase, "", ""), "/")
+}
+
+// SearchEnabledItems returns the uuids of the items in the configured collections, or in the whole
+// repository, that have IIIF search enabled.
+func SearchEnabledItems(settings model.Configuration, log *logging.Logger) ([]string, error) {
+	scopes := settings.Collections
+	if len(scopes) == 0 {
+		scopes = []string{""}
+	}
+	var items []string
+	for _, scope := range scopes {
+		for page := 0; ; page++ {
+			response, err := SearchModifiedItems(settings, scope, "", page, log)
+			if err != nil {
+				return nil, err
+			}
+			for _, item := range response.Items() {
+				if item.SearchEnabled() {
+					items = append(items, item.Id)
+				}
+			}
+			if page+1 >= response.Embedded.SearchResult.Page.TotalPages {
+				break
+			}
+		}
+	}
+	return items, nil
+}
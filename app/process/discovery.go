@@ -0,0 +1,47 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/url"
+)
+
+// discoveryPageSize is the number of items requested from the DSpace discovery search at a time.
+const discoveryPageSize = 100
+
+// SearchModifiedItems returns a page of the items modified at or after the since time (a Solr date, or
+// empty for all items), sorted by modification time. The scope is a collection uuid or empty for all
+// collections. The discovery configuration must include withdrawn and private items (e.g.
+// administrativeView) for these to be found.
+func SearchModifiedItems(settings model.Configuration, scope string, since string, page int,
+	log *logging.Logger) (model.DiscoveryResponse, error) {
+	var response model.DiscoveryResponse
+	query := url.Values{}
+	query.Set("dsoType", "ITEM")
+	query.Set("sort", "lastModified,ASC")
+	query.Set("page", fmt.Sprint(page))
+	query.Set("size", fmt.Sprint(discoveryPageSize))
+	if len(scope) > 0 {
+		query.Set("scope", scope)
+	}
+	if len(since) > 0 {
+		query.Set("query", "lastModified:["+since+" TO *]")
+	}
+	if len(settings.PollConfiguration) > 0 {
+		query.Set("configuration", settings.PollConfiguration)
+	}
+	resp, err := dspaceGet("discovery", settings.DSpaceHost+"/api/discover/search/objects?"+query.Encode(),
+		settings, log)
+	if err != nil {
+		return response, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return response, UnProcessableEntity{CAUSE: "Could not search DSpace. Status:  " + resp.Status}
+	}
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	return response, err
+}
@@ -1,24 +1,27 @@
 package process
 
 import (
+	"encoding/json"
+	"errors"
 	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
 	"io"
-	"log"
-	"net/http"
+	"strings"
 )
 
 // GetManifest fetches the manifest from DSpace
-func GetManifest(host string, uuid string, log *log.Logger) ([]byte, error) {
-	endpoint := getDSpaceApiEndpoint(host, uuid, "manifest")
-	resp, err := http.Get(endpoint)
+func GetManifest(settings model.Configuration, uuid string, log *logging.Logger) ([]byte, error) {
+	endpoint := getDSpaceApiEndpoint(settings.DSpaceHost, uuid, "manifest")
+	resp, err := dspaceGet("manifest", endpoint, settings, log)
 	if err != nil {
-		log.Println(err.Error())
+		log.Error("DSpace request failed", logging.Err(err))
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close DSpace Manifest response.")
+			log.Warn("Unable to close DSpace Manifest response.")
 		}
 	}(resp.Body)
 	if resp.StatusCode != 200 {
@@ -29,16 +32,16 @@ func GetManifest(host string, uuid string, log *log.Logger) ([]byte, error) {
 }
 
 // GetAnnotationList fetches the annotation list from DSpace
-func GetAnnotationList(id string, log *log.Logger) ([]byte, error) {
-	resp, err := http.Get(id)
+func GetAnnotationList(settings model.Configuration, id string, log *logging.Logger) ([]byte, error) {
+	resp, err := dspaceGet("annotations", id, settings, log)
 	if err != nil {
-		log.Println(err.Error())
+		log.Error("DSpace request failed", logging.Err(err))
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close DSpace AnnotationList response.")
+			log.Warn("Unable to close DSpace AnnotationList response.")
 		}
 	}(resp.Body)
 	if resp.StatusCode != 200 {
@@ -49,16 +52,16 @@ func GetAnnotationList(id string, log *log.Logger) ([]byte, error) {
 }
 
 // GetMetsXml fetches a mets file from DSpace
-func GetMetsXml(url string, log *log.Logger) ([]byte, error) {
-	resp, err := http.Get(url)
+func GetMetsXml(settings model.Configuration, url string, log *logging.Logger) ([]byte, error) {
+	resp, err := dspaceGet("mets", url, settings, log)
 	if err != nil {
-		log.Println(err.Error())
+		log.Error("DSpace request failed", logging.Err(err))
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close DSpace METS response.")
+			log.Warn("Unable to close DSpace METS response.")
 		}
 	}(resp.Body)
 	if resp.StatusCode != 200 {
@@ -69,32 +72,59 @@ func GetMetsXml(url string, log *log.Logger) ([]byte, error) {
 }
 
 // GetOcrXml fetches an alto file from DSpace
-func GetOcrXml(url string, log *log.Logger) ([]byte, error) {
-	resp, err := http.Get(url)
+func GetOcrXml(settings model.Configuration, url string, log *logging.Logger) ([]byte, error) {
+	resp, err := dspaceGet("ocr", url, settings, log)
 	if err != nil {
 		return nil, err
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close DSpace OCR response.")
+			log.Warn("Unable to close DSpace OCR response.")
 		}
 	}(resp.Body)
 	if resp.StatusCode != 200 {
-		log.Println(err.Error())
 		errorMessage := UnProcessableEntity{CAUSE: "Could not retrieve OCR file. Status:  " + resp.Status}
 		return nil, errorMessage
 	}
-	log.Println("Proccessing OCR file: " + url)
+	log.Debug("Retrieved OCR file from DSpace", logging.F("url", url))
 	return responseReader(resp.Body)
 }
 
+// GetBitstreamChecksum returns the MD5 checksum of a bitstream from the DSpace bitstream metadata. The url is
+// the content url of the bitstream. An error is returned if the checksum is not available or not MD5.
+func GetBitstreamChecksum(settings model.Configuration, url string, log *logging.Logger) (string, error) {
+	if !strings.HasSuffix(url, "/content") {
+		return "", errors.New("not a bitstream content url: " + url)
+	}
+	resp, err := dspaceGet("bitstream", strings.TrimSuffix(url, "/content"), settings, log)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			log.Warn("Unable to close DSpace bitstream response.")
+		}
+	}(resp.Body)
+	if resp.StatusCode != 200 {
+		return "", UnProcessableEntity{CAUSE: "Could not retrieve bitstream. Status:  " + resp.Status}
+	}
+	var bitstream model.Bitstream
+	if err := json.NewDecoder(resp.Body).Decode(&bitstream); err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(bitstream.CheckSum.Algorithm, "MD5") || len(bitstream.CheckSum.Value) == 0 {
+		return "", errors.New("MD5 checksum not available for bitstream: " + url)
+	}
+	return strings.ToLower(bitstream.CheckSum.Value), nil
+}
+
 // responseReader returns the body of the Http response as a byte array.
 func responseReader(reader io.ReadCloser) ([]byte, error) {
 	defer reader.Close()
 	body, err := io.ReadAll(reader)
 	if err != nil {
-		log.Println(err.Error())
 		return nil, err
 	}
 	return body, nil
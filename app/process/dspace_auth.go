@@ -0,0 +1,246 @@
+package process
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
+	"github.com/mspalti/ocrprocessor/model"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	csrfHeader        = "DSPACE-XSRF-TOKEN"
+	csrfRequestHeader = "X-XSRF-TOKEN"
+	// tokenExpiryMargin is subtracted from the token expiration so that the token is refreshed before
+	// DSpace rejects it.
+	tokenExpiryMargin = time.Minute
+	// defaultTokenLifetime is used when the expiration cannot be read from the token.
+	defaultTokenLifetime = 25 * time.Minute
+)
+
+// dspaceSession holds the authentication state for a DSpace REST API user.
+type dspaceSession struct {
+	mutex    sync.Mutex
+	host     string
+	user     string
+	password string
+	client   *http.Client
+	token    string
+	csrf     string
+	expires  time.Time
+}
+
+var dspaceSessions = struct {
+	sync.Mutex
+	sessions map[string]*dspaceSession
+}{sessions: make(map[string]*dspaceSession)}
+
+// getDSpaceSession returns the shared session for the configured DSpace user or nil if no
+// credentials are configured.
+func getDSpaceSession(settings model.Configuration) *dspaceSession {
+	if len(settings.DSpaceUser) == 0 {
+		return nil
+	}
+	key := settings.DSpaceHost + "|" + settings.DSpaceUser
+	dspaceSessions.Lock()
+	defer dspaceSessions.Unlock()
+	session, ok := dspaceSessions.sessions[key]
+	if !ok || session.password != settings.DSpacePassword {
+		jar, _ := cookiejar.New(nil)
+		session = &dspaceSession{
+			host:     settings.DSpaceHost,
+			user:     settings.DSpaceUser,
+			password: settings.DSpacePassword,
+			client:   &http.Client{Jar: jar},
+		}
+		dspaceSessions.sessions[key] = session
+	}
+	return session
+}
+
+// dspaceGet fetches the url from DSpace and records request metrics for the endpoint. When DSpace
+// credentials are configured the request carries the bearer token of the authenticated user. The
+// request is retried once with a new login if DSpace reports that the token is no longer valid.
+func dspaceGet(endpoint string, url string, settings model.Configuration, log *logging.Logger) (*http.Response, error) {
+	start := time.Now()
+	resp, err := authenticatedGet(url, settings, log)
+	metrics.DSpaceRequestSeconds.ObserveDuration(start, endpoint)
+	metrics.DSpaceRequests.Inc(endpoint, metrics.StatusCode(resp, err))
+	return resp, err
+}
+
+// authenticatedGet executes the GET request, adding DSpace authentication if credentials are configured.
+func authenticatedGet(url string, settings model.Configuration, log *logging.Logger) (*http.Response, error) {
+	session := getDSpaceSession(settings)
+	if session == nil {
+		return http.Get(url)
+	}
+	resp, err := session.get(url, log)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		log.Info("DSpace rejected the authentication token, logging in again.")
+		session.invalidate()
+		return session.get(url, log)
+	}
+	return resp, nil
+}
+
+// get executes an authenticated GET request.
+func (s *dspaceSession) get(url string, log *logging.Logger) (*http.Response, error) {
+	token, err := s.authorization(log)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", token)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	s.updateCsrf(resp)
+	return resp, nil
+}
+
+// authorization returns a valid Authorization header value, logging in or refreshing the token as needed.
+func (s *dspaceSession) authorization(log *logging.Logger) (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := time.Now()
+	if len(s.token) > 0 && now.Before(s.expires.Add(-tokenExpiryMargin)) {
+		return s.token, nil
+	}
+	if len(s.token) > 0 && now.Before(s.expires) {
+		if err := s.refresh(); err == nil {
+			return s.token, nil
+		}
+		log.Warn("Unable to refresh the DSpace authentication token, logging in again.")
+	}
+	if err := s.login(); err != nil {
+		log.Error("DSpace login failed", logging.Err(err), logging.F("user", s.user))
+		return "", err
+	}
+	return s.token, nil
+}
+
+// invalidate discards the current token so that the next request logs in again.
+func (s *dspaceSession) invalidate() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.token = ""
+}
+
+// login authenticates with the DSpace password authentication endpoint.
+func (s *dspaceSession) login() error {
+	if err := s.fetchCsrf(); err != nil {
+		return err
+	}
+	form := url.Values{}
+	form.Set("user", s.user)
+	form.Set("password", s.password)
+	req, err := http.NewRequest("POST", s.host+"/api/authn/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return s.authenticate(req)
+}
+
+// refresh requests a new token for the current session.
+func (s *dspaceSession) refresh() error {
+	req, err := http.NewRequest("POST", s.host+"/api/authn/login", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", s.token)
+	return s.authenticate(req)
+}
+
+// authenticate posts the login request and stores the token returned by DSpace.
+func (s *dspaceSession) authenticate(req *http.Request) error {
+	req.Header.Set(csrfRequestHeader, s.csrf)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.New("could not log in to DSpace: " + err.Error())
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	s.updateCsrfLocked(resp)
+	if resp.StatusCode != 200 {
+		s.token = ""
+		return errors.New("could not log in to DSpace. Status: " + resp.Status)
+	}
+	token := resp.Header.Get("Authorization")
+	if len(token) == 0 {
+		s.token = ""
+		return errors.New("DSpace login response did not include an authentication token")
+	}
+	s.token = token
+	s.expires = tokenExpiration(token)
+	return nil
+}
+
+// fetchCsrf requests a CSRF token from DSpace. The token is returned in a response header and
+// the matching cookie is kept by the session cookie jar.
+func (s *dspaceSession) fetchCsrf() error {
+	resp, err := s.client.Get(s.host + "/api/authn/status")
+	if err != nil {
+		return errors.New("could not retrieve DSpace CSRF token: " + err.Error())
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	s.updateCsrfLocked(resp)
+	if len(s.csrf) == 0 {
+		return errors.New("DSpace did not return a CSRF token")
+	}
+	return nil
+}
+
+// updateCsrf records a new CSRF token if DSpace issued one with the response.
+func (s *dspaceSession) updateCsrf(resp *http.Response) {
+	if len(resp.Header.Get(csrfHeader)) == 0 {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.updateCsrfLocked(resp)
+}
+
+func (s *dspaceSession) updateCsrfLocked(resp *http.Response) {
+	if csrf := resp.Header.Get(csrfHeader); len(csrf) > 0 {
+		s.csrf = csrf
+	}
+}
+
+// tokenExpiration reads the expiration claim from the JWT bearer token.
+func tokenExpiration(token string) time.Time {
+	fallback := time.Now().Add(defaultTokenLifetime)
+	parts := strings.Split(strings.TrimPrefix(token, "Bearer "), ".")
+	if len(parts) != 3 {
+		return fallback
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return fallback
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return fallback
+	}
+	return time.Unix(claims.Exp, 0)
+}
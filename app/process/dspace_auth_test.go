@@ -0,0 +1,72 @@
+package process
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func fakeToken(expires time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"exp":%d}`, expires.Unix())))
+	return "Bearer header." + payload + ".signature"
+}
+
+func TestDSpaceGetWithAuthentication(t *testing.T) {
+	token := fakeToken(time.Now().Add(time.Hour))
+	logins := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/authn/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(csrfHeader, "csrf-token")
+	})
+	mux.HandleFunc("/api/authn/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(csrfRequestHeader) != "csrf-token" || r.FormValue("password") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		logins++
+		w.Header().Set("Authorization", token)
+	})
+	mux.HandleFunc("/bitstream", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != token {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("<ocr/>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	settings := model.Configuration{DSpaceHost: server.URL, DSpaceUser: "user@dspace.edu", DSpacePassword: "secret"}
+	for i := 0; i < 2; i++ {
+		ocr, err := GetOcrXml(settings, server.URL+"/bitstream", logging.Discard())
+		if err != nil {
+			t.Fatalf("expected restricted file to be retrieved: %s", err.Error())
+		}
+		if string(ocr) != "<ocr/>" {
+			t.Errorf("unexpected response: %s", string(ocr))
+		}
+	}
+	if logins != 1 {
+		t.Errorf("expected a single login for repeated requests, got %d", logins)
+	}
+
+	settings.DSpaceUser = ""
+	if _, err := GetOcrXml(settings, server.URL+"/bitstream", logging.Discard()); err == nil {
+		t.Errorf("expected anonymous request to fail")
+	}
+}
+
+func TestTokenExpiration(t *testing.T) {
+	expires := time.Unix(time.Now().Add(time.Hour).Unix(), 0)
+	if !tokenExpiration(fakeToken(expires)).Equal(expires) {
+		t.Errorf("expected expiration to be read from the token")
+	}
+	if tokenExpiration("Bearer invalid").Before(time.Now()) {
+		t.Errorf("expected default lifetime for unreadable token")
+	}
+}
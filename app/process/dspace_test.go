@@ -0,0 +1,35 @@
+package process
+
+import (
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetBitstreamChecksum(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/core/bitstreams/md5":
+			_, _ = w.Write([]byte(`{"uuid":"md5","checkSum":{"checkSumAlgorithm":"MD5","value":"ABC123"}}`))
+		case "/api/core/bitstreams/sha":
+			_, _ = w.Write([]byte(`{"uuid":"sha","checkSum":{"checkSumAlgorithm":"SHA-256","value":"def"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	settings := model.Configuration{DSpaceHost: server.URL}
+	sum, err := GetBitstreamChecksum(settings, server.URL+"/api/core/bitstreams/md5/content", logging.Discard())
+	if err != nil || sum != "abc123" {
+		t.Errorf("expected MD5 checksum, got %q %v", sum, err)
+	}
+	if _, err := GetBitstreamChecksum(settings, server.URL+"/api/core/bitstreams/sha/content", logging.Discard()); err == nil {
+		t.Errorf("expected error for unsupported checksum algorithm")
+	}
+	if _, err := GetBitstreamChecksum(settings, server.URL+"/bitstream", logging.Discard()); err == nil {
+		t.Errorf("expected error for url that is not a bitstream content url")
+	}
+}
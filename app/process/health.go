@@ -0,0 +1,126 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/storage"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ocrCharFilter is the name of the solr-ocrhighlighting char filter that identifies the OCR field type.
+const ocrCharFilter = "OcrCharFilterFactory"
+
+// PingSolr verifies that the Solr core responds to the ping request handler.
+func PingSolr(settings model.Configuration) error {
+	resp, err := solrRequest(settings, "GET", "admin/ping?wt=json", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var ping struct {
+		Status string `json:"status"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ping); err != nil {
+		return err
+	}
+	if ping.Status != "OK" {
+		return errors.New("solr ping status: " + ping.Status)
+	}
+	return nil
+}
+
+// CheckSolrSchema verifies that the Solr schema defines the manifest and OCR fields and that the
+// OCR field uses a field type with the solr-ocrhighlighting char filter.
+func CheckSolrSchema(settings model.Configuration) error {
+	fields := solrFields(settings)
+	if _, err := schemaFieldType(settings, fields.ManifestUrl); err != nil {
+		return err
+	}
+	fieldType, err := schemaFieldType(settings, fields.OcrText)
+	if err != nil {
+		return err
+	}
+	resp, err := solrRequest(settings, "GET", "schema/fieldtypes/"+fieldType+"?wt=json", nil)
+	if err != nil {
+		return errors.New("could not retrieve solr field type " + fieldType + ": " + err.Error())
+	}
+	defer resp.Body.Close()
+	definition, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(string(definition), ocrCharFilter) {
+		return fmt.Errorf("the field type %s of the %s field does not use the OCR highlighting %s",
+			fieldType, fields.OcrText, ocrCharFilter)
+	}
+	return nil
+}
+
+// schemaFieldType returns the field type of a Solr schema field or an error if the field is not defined.
+func schemaFieldType(settings model.Configuration, name string) (string, error) {
+	resp, err := solrRequest(settings, "GET", "schema/fields/"+name+"?wt=json", nil)
+	if err != nil {
+		return "", errors.New("solr schema field " + name + " not found: " + err.Error())
+	}
+	defer resp.Body.Close()
+	var field struct {
+		Field struct {
+			Type string `json:"type"`
+		} `json:"field"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&field); err != nil {
+		return "", err
+	}
+	return field.Field.Type, nil
+}
+
+// healthCheckUuid is the Item requested from the IIIF endpoint if no health check Item is configured.
+const healthCheckUuid = "00000000-0000-0000-0000-000000000000"
+
+// PingDSpace verifies that DSpace responds. If a health check Item is configured, the IIIF manifest
+// for the Item is requested. Otherwise, the root of the DSpace REST API and the IIIF manifest of an Item
+// that does not exist are requested from the dspace_host and the manifest_base. The IIIF endpoint must
+// respond with 200 or 404 in that case.
+func PingDSpace(settings model.Configuration, log *logging.Logger) error {
+	if len(settings.HealthCheckItem) > 0 {
+		_, err := GetManifest(settings, settings.HealthCheckItem, log)
+		return err
+	}
+	if err := pingDSpace("api", settings.DSpaceHost+"/api", settings, log, http.StatusOK); err != nil {
+		return err
+	}
+	// the probe is counted separately, so that it does not add failures to the manifest metrics
+	return pingDSpace("health", getDSpaceApiEndpoint(settings.ManifestBase, healthCheckUuid, "manifest"),
+		settings, log, http.StatusOK, http.StatusNotFound)
+}
+
+// pingDSpace requests the url and returns an error if the response status is not one of the expected
+// statuses.
+func pingDSpace(endpoint string, url string, settings model.Configuration, log *logging.Logger,
+	expected ...int) error {
+	resp, err := dspaceGet(endpoint, url, settings, log)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for _, status := range expected {
+		if resp.StatusCode == status {
+			return nil
+		}
+	}
+	return errors.New("DSpace request failed: " + url + " Status: " + resp.Status)
+}
+
+// CheckFileLocation verifies that lazy loaded OCR files can be stored.
+func CheckFileLocation(settings model.Configuration) error {
+	store, err := storage.New(settings)
+	if err != nil {
+		return err
+	}
+	return store.Check()
+}
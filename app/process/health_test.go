@@ -0,0 +1,33 @@
+package process
+
+import (
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPingDSpace(t *testing.T) {
+	iiifStatus := http.StatusNotFound
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/iiif/"+healthCheckUuid+"/manifest" {
+			w.WriteHeader(iiifStatus)
+		}
+	}))
+	defer server.Close()
+
+	settings := model.Configuration{DSpaceHost: server.URL + "/server", ManifestBase: server.URL}
+	if err := PingDSpace(settings, logging.Discard()); err != nil {
+		t.Errorf("expected an unknown Item response from the IIIF endpoint to pass: %v", err)
+	}
+	if len(paths) != 2 || paths[0] != "/server/api" || paths[1] != "/iiif/"+healthCheckUuid+"/manifest" {
+		t.Errorf("expected the REST API and the IIIF endpoint of the manifest base to be requested, got %v", paths)
+	}
+	iiifStatus = http.StatusBadGateway
+	if err := PingDSpace(settings, logging.Discard()); err == nil {
+		t.Error("expected a failing IIIF endpoint to fail the check")
+	}
+}
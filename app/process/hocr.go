@@ -5,36 +5,40 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	"github.com/mspalti/ocrprocessor/model"
 	"io"
-	"log"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var pageBBox = regexp.MustCompile(`bbox 0 0 (\d+) (\d+)`)
 var wordBBox = regexp.MustCompile(`bbox (\d+) (\d+) (\d+) (\d+)`)
 
-func (processor HocrProcessor) ProcessOcr(uuid *string, fileName string, ocr *[]byte, position int,
-	manifestId string, settings model.Configuration, log *log.Logger) error {
-	updatedOcr, err := updateXML(ocr, position, settings)
+func (processor HocrProcessor) ProcessOcr(page model.OcrPage, ocr *[]byte, settings model.Configuration,
+	log *logging.Logger) error {
+	start := time.Now()
+	updatedOcr, err := updateXML(ocr, page.Position, settings)
 	if err != nil {
 		return err
 	}
 	if settings.ConvertToMiniOcr {
-		updatedOcr, err = convert(updatedOcr, position, settings)
+		updatedOcr, err = convert(updatedOcr, page.Position, settings)
 		if err != nil {
 			return err
 		}
 	}
-	if settings.IndexType == "lazy" {
-		err = PostToSolrLazyLoad(uuid, fileName, updatedOcr, manifestId, settings, log)
+	metrics.ConversionSeconds.ObserveDuration(start, HocrFormat.String())
+	if settings.IndexType == LazyIndex {
+		err = PostToSolrLazyLoad(page, updatedOcr, settings, log)
 		if err != nil {
 			return errors.New("hOCR indexing failed: " + err.Error())
 		}
 	} else {
-		err = PostToSolr(uuid, fileName, updatedOcr, manifestId, settings, log)
+		err = PostToSolr(page, updatedOcr, settings, log)
 		if err != nil {
 			return errors.New("hOCR indexing failed: " + err.Error())
 		}
@@ -66,7 +70,6 @@ func convert(original *string, position int, settings model.Configuration) (*str
 		}
 		if err != nil {
 			return nil, err
-			break
 		}
 
 		switch t := token.(type) {
@@ -174,7 +177,7 @@ func convert(original *string, position int, settings model.Configuration) (*str
 		return nil, err
 	}
 	out := string(marshalledXml)
-	if settings.IndexType == "full" && settings.ConvertToMiniOcr == false {
+	if settings.IndexType == FullIndex && settings.ConvertToMiniOcr == false {
 		// use single quotes to submit the XML in solr post
 		out = strings.ReplaceAll(out, "\"", "'")
 	}
@@ -186,7 +189,7 @@ func convert(original *string, position int, settings model.Configuration) (*str
 func updateXML(hocr *[]byte, position int, settings model.Configuration) (*string, error) {
 
 	// There is no need to update when full indexing without character conversion is requested.
-	if !settings.EscapeUtf8 && settings.IndexType != "lazy" {
+	if !settings.EscapeUtf8 && settings.IndexType != LazyIndex {
 		out := string(*hocr)
 		return &out, nil
 	}
@@ -204,8 +207,7 @@ func updateXML(hocr *[]byte, position int, settings model.Configuration) (*strin
 			break
 		}
 		if err != nil {
-			log.Printf("error getting token: %t\n", err)
-			return nil, err
+			return nil, errors.New("error getting token: " + err.Error())
 		}
 
 		switch t := token.(type) {
@@ -236,7 +238,7 @@ func updateXML(hocr *[]byte, position int, settings model.Configuration) (*strin
 				continue
 			}
 
-			if hasClassValue(t, "ocrx_word") && settings.EscapeUtf8 && settings.IndexType == "lazy" {
+			if hasClassValue(t, "ocrx_word") && settings.EscapeUtf8 && settings.IndexType == LazyIndex {
 				if err := encoder.EncodeToken(t); err != nil {
 					return nil, err
 				}
@@ -0,0 +1,325 @@
+package process
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/storage"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultFileLayout is the layout of lazy loaded OCR files used if none is configured: a flat directory
+// of files named with the item uuid and page name.
+const DefaultFileLayout = "{uuid}-{page}.xml"
+
+// maxFileNameLength is the maximum length of the page part of a file name.
+const maxFileNameLength = 200
+
+// layoutPlaceholder matches the {uuid}, {uuid[start:end]} and {page} placeholders of a file layout.
+var layoutPlaceholder = regexp.MustCompile(`\{(?:uuid(?:\[(\d+):(\d+)\])?|page)\}`)
+
+var unsafeFileCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileNameHashLength is the number of hex digits of the name hash added to changed file names.
+const fileNameHashLength = 12
+
+// fileNameHash matches names that end like a changed file name.
+var fileNameHash = regexp.MustCompile(`_[0-9a-f]{` + strconv.Itoa(fileNameHashLength) + `}$`)
+
+// ValidateFileLayout returns an error if the layout has unknown placeholders, or does not include
+// the {uuid} and {page} placeholders that make file paths unique.
+func ValidateFileLayout(layout string) error {
+	rest := layoutPlaceholder.ReplaceAllString(layout, "")
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("invalid lazy_file_layout %q: unknown placeholder", layout)
+	}
+	if !strings.Contains(layout, "{uuid}") || !strings.Contains(layout, "{page}") {
+		return fmt.Errorf("invalid lazy_file_layout %q: {uuid} and {page} are required", layout)
+	}
+	if filepath.IsAbs(layout) {
+		return fmt.Errorf("invalid lazy_file_layout %q: the layout must be relative to xml_file_location", layout)
+	}
+	return nil
+}
+
+// SafeFileName replaces characters other than letters, digits, dot, underscore and hyphen in a file
+// name, and names that are empty or only dots, so that the name cannot add directories to a path.
+// Names that are replaced or shortened end with a hash of the original name, so that different names,
+// e.g. "page 1" and "page/1", have different file names. Safe names are not changed, unless they end
+// like a changed name.
+func SafeFileName(name string) string {
+	safe := unsafeFileCharacters.ReplaceAllString(name, "_")
+	if strings.Trim(safe, ".") == "" {
+		safe = strings.Repeat("_", len(safe)+1)
+	}
+	if safe == name && len(name) <= maxFileNameLength && !fileNameHash.MatchString(name) {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	suffix := "_" + hex.EncodeToString(sum[:])[:fileNameHashLength]
+	if len(safe) > maxFileNameLength-len(suffix) {
+		safe = safe[:maxFileNameLength-len(suffix)]
+	}
+	return safe + suffix
+}
+
+// LazyFilePath returns the path of the lazy loaded OCR file for the page of the item, using the
+// configured layout relative to the xml_file_location. The uuid and page are sanitized, and paths
+// outside of the xml_file_location are rejected.
+func LazyFilePath(settings model.Configuration, uuid string, page string) (string, error) {
+	return layoutPath(settings, SafeFileName(uuid), SafeFileName(page))
+}
+
+// itemFiles returns the stored lazy loaded OCR files of the item, found with the layout.
+func itemFiles(settings model.Configuration, uuid string) ([]string, error) {
+	// the sanitized uuid has no glob characters, so only the page is matched
+	pattern, err := layoutPath(settings, SafeFileName(uuid), "*")
+	if err != nil {
+		return nil, err
+	}
+	keyPattern, err := fileKey(settings, pattern)
+	if err != nil {
+		return nil, err
+	}
+	store, err := storage.New(settings)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	err = store.List(keyPattern[:strings.Index(keyPattern, "*")], func(object storage.Object) error {
+		if matched, _ := path.Match(keyPattern, object.Key); matched {
+			files = append(files, filePath(settings, object.Key))
+		}
+		return nil
+	})
+	return files, err
+}
+
+func layoutPath(settings model.Configuration, uuid string, page string) (string, error) {
+	layout := settings.LazyFileLayout
+	if len(layout) == 0 {
+		layout = DefaultFileLayout
+	}
+	if err := ValidateFileLayout(layout); err != nil {
+		return "", err
+	}
+	var expandErr error
+	relative := layoutPlaceholder.ReplaceAllStringFunc(layout, func(placeholder string) string {
+		if placeholder == "{page}" {
+			return page
+		}
+		match := layoutPlaceholder.FindStringSubmatch(placeholder)
+		if len(match[1]) == 0 {
+			return uuid
+		}
+		start, _ := strconv.Atoi(match[1])
+		end, _ := strconv.Atoi(match[2])
+		if start > end || end > len(uuid) {
+			expandErr = fmt.Errorf("lazy_file_layout placeholder %s is out of range for %q", placeholder, uuid)
+			return ""
+		}
+		return uuid[start:end]
+	})
+	if expandErr != nil {
+		return "", expandErr
+	}
+	root := filepath.Clean(settings.XmlFileLocation)
+	path := filepath.Join(root, relative)
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("lazy file path is outside of xml_file_location: " + path)
+	}
+	return path, nil
+}
+
+// uuidExpression matches DSpace uuids in file paths.
+const uuidExpression = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+
+// FileItemMatcher returns a function that returns the uuid of the item of a lazy loaded OCR file path,
+// and false if the path is not the path of a page file in the configured layout.
+func FileItemMatcher(settings model.Configuration) (func(path string) (string, bool), error) {
+	layout := settings.LazyFileLayout
+	if len(layout) == 0 {
+		layout = DefaultFileLayout
+	}
+	if err := ValidateFileLayout(layout); err != nil {
+		return nil, err
+	}
+	var expression strings.Builder
+	expression.WriteString("^")
+	uuidGroup, pageGroup := false, false
+	last := 0
+	for _, match := range layoutPlaceholder.FindAllStringSubmatchIndex(layout, -1) {
+		expression.WriteString(regexp.QuoteMeta(layout[last:match[0]]))
+		last = match[1]
+		switch {
+		case layout[match[0]:match[1]] == "{page}" && !pageGroup:
+			expression.WriteString(`(?P<page>[A-Za-z0-9._-]+)`)
+			pageGroup = true
+		case layout[match[0]:match[1]] == "{page}":
+			expression.WriteString(`[A-Za-z0-9._-]+`)
+		case match[2] >= 0:
+			expression.WriteString(`[0-9a-fA-F-]*`)
+		case !uuidGroup:
+			expression.WriteString(`(?P<uuid>` + uuidExpression + `)`)
+			uuidGroup = true
+		default:
+			expression.WriteString(uuidExpression)
+		}
+	}
+	expression.WriteString(regexp.QuoteMeta(layout[last:]) + "$")
+	pattern, err := regexp.Compile(expression.String())
+	if err != nil {
+		return nil, err
+	}
+	return func(path string) (string, bool) {
+		key, err := fileKey(settings, path)
+		if err != nil {
+			return "", false
+		}
+		match := pattern.FindStringSubmatch(key)
+		if match == nil {
+			return "", false
+		}
+		uuid := match[pattern.SubexpIndex("uuid")]
+		// the parts of the uuid and repeated placeholders must match the path of the page
+		expected, err := layoutPath(settings, uuid, match[pattern.SubexpIndex("page")])
+		if err != nil || expected != filePath(settings, key) {
+			return "", false
+		}
+		return uuid, true
+	}, nil
+}
+
+// MigrationResult reports the lazy loaded OCR files moved by MigrateFiles.
+type MigrationResult struct {
+	Moved     int      `json:"moved"`
+	Unchanged int      `json:"unchanged"`
+	Errors    []string `json:"errors,omitempty"`
+}
+
+// fileMove is a lazy loaded OCR file to move to the path of the configured layout.
+type fileMove struct {
+	doc    IndexedDocument
+	target string
+}
+
+// MigrateFiles moves the lazy loaded OCR files of all documents to the paths of the configured layout and
+// updates the ocr_text field of the documents with Solr atomic updates. The files of an item are moved
+// back if its documents cannot be updated. Indexing should be paused while files are migrated.
+func MigrateFiles(settings model.Configuration, log *logging.Logger) (MigrationResult, error) {
+	var result MigrationResult
+	var order []string
+	moves := make(map[string][]fileMove)
+	err := ScanDocuments(settings, func(doc IndexedDocument) error {
+		if len(doc.FilePath) == 0 {
+			return nil
+		}
+		uuid, ok := ManifestItem(settings, doc.ManifestUrl)
+		if !ok {
+			result.Errors = append(result.Errors, "unknown manifest url for "+doc.SolrId+": "+doc.ManifestUrl)
+			return nil
+		}
+		target, err := LazyFilePath(settings, uuid, documentPageId(doc.SolrId, uuid))
+		if err != nil {
+			result.Errors = append(result.Errors, doc.SolrId+": "+err.Error())
+			return nil
+		}
+		if filepath.Clean(doc.FilePath) == target {
+			result.Unchanged++
+			return nil
+		}
+		if _, ok := moves[uuid]; !ok {
+			order = append(order, uuid)
+		}
+		moves[uuid] = append(moves[uuid], fileMove{doc: doc, target: target})
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	for _, uuid := range order {
+		moved, err := migrateItem(settings, uuid, moves[uuid])
+		if err != nil {
+			log.Warn("Unable to migrate OCR files.", logging.F(logging.ItemKey, uuid), logging.Err(err))
+			result.Errors = append(result.Errors, uuid+": "+err.Error())
+			continue
+		}
+		result.Moved += moved
+	}
+	if err := CommitSolr(settings); err != nil {
+		return result, err
+	}
+	log.Info("OCR file migration completed.", logging.F("moved", result.Moved),
+		logging.F("unchanged", result.Unchanged), logging.F("errors", len(result.Errors)))
+	return result, nil
+}
+
+// migrateItem moves the files of an item and updates its documents.
+func migrateItem(settings model.Configuration, uuid string, moves []fileMove) (int, error) {
+	store, err := storage.New(settings)
+	if err != nil {
+		return 0, err
+	}
+	fields := solrFields(settings)
+	var updates []map[string]interface{}
+	var renamed [][2]string
+	undo := func() {
+		for _, keys := range renamed {
+			_ = store.Rename(keys[1], keys[0])
+		}
+	}
+	for _, move := range moves {
+		from, err := fileKey(settings, move.doc.FilePath)
+		if err != nil {
+			undo()
+			return 0, err
+		}
+		to, err := fileKey(settings, move.target)
+		if err != nil {
+			undo()
+			return 0, err
+		}
+		if err := store.Rename(from, to); err != nil {
+			// a file moved by an earlier migration that was interrupted before the update
+			if exists, existsErr := store.Exists(to); existsErr != nil || !exists {
+				undo()
+				return 0, err
+			}
+		} else {
+			renamed = append(renamed, [2]string{from, to})
+		}
+		path := move.target
+		if move.doc.Escaped {
+			path += "{ascii}"
+		}
+		updates = append(updates, map[string]interface{}{fields.Id: move.doc.SolrId,
+			fields.OcrText: map[string]string{"set": path}})
+	}
+	payloadBuf := new(bytes.Buffer)
+	if err := json.NewEncoder(payloadBuf).Encode(updates); err != nil {
+		undo()
+		return 0, err
+	}
+	resp, err := solrRequest(settings, "POST", "update?"+routeParam(settings, uuid), payloadBuf)
+	if err != nil {
+		undo()
+		return 0, errors.New("could not update solr documents: " + err.Error())
+	}
+	resp.Body.Close()
+	return len(moves), nil
+}
+
+// RemoveFile removes a lazy loaded OCR file from storage.
+func RemoveFile(settings model.Configuration, path string) error {
+	return deleteFiles(settings, []string{path})
+}
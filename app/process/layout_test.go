@@ -0,0 +1,149 @@
+package process
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const layoutUuid = "413065ef-e242-4d0e-867d-8e2f6486be56"
+
+func TestSafeFileName(t *testing.T) {
+	tests := map[string]string{
+		"page1":          "page1",
+		"page_1.xml":     "page_1.xml",
+		"page 1.xml":     "page_1.xml_",
+		"../../etc/pass": ".._.._etc_pass_",
+		"..":             "____",
+		"":               "__",
+		"a/b\\c":         "a_b_c_",
+	}
+	for name, expected := range tests {
+		safe := SafeFileName(name)
+		if strings.HasSuffix(expected, "_") {
+			// changed names end with a hash of the name
+			expected += hashSuffix(name)
+		}
+		if safe != expected {
+			t.Errorf("SafeFileName(%q) = %q, expected %q", name, safe, expected)
+		}
+	}
+	names := map[string]string{}
+	for _, name := range []string{"page 1", "page_1", "page/1", "page\\1", "page_1_" + hashSuffix("page 1")} {
+		safe := SafeFileName(name)
+		if other, ok := names[safe]; ok {
+			t.Errorf("SafeFileName(%q) = SafeFileName(%q) = %q", name, other, safe)
+		}
+		names[safe] = name
+	}
+	if long := SafeFileName(strings.Repeat("a", 300)); len(long) != maxFileNameLength {
+		t.Errorf("expected long names to be shortened to %d characters, got %d", maxFileNameLength, len(long))
+	}
+}
+
+// hashSuffix returns the hash that SafeFileName adds to changed names.
+func hashSuffix(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:fileNameHashLength]
+}
+
+func TestLazyFilePath(t *testing.T) {
+	settings := model.Configuration{XmlFileLocation: "/var/ocr_files"}
+	path, err := LazyFilePath(settings, layoutUuid, "page 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/var/ocr_files/"+layoutUuid+"-page_1_"+hashSuffix("page 1")+".xml" {
+		t.Errorf("unexpected default path: %s", path)
+	}
+	settings.LazyFileLayout = "{uuid[0:2]}/{uuid}/{page}.xml"
+	path, err = LazyFilePath(settings, layoutUuid, "../../page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != "/var/ocr_files/41/"+layoutUuid+"/.._.._page_"+hashSuffix("../../page")+".xml" {
+		t.Errorf("unexpected sharded path: %s", path)
+	}
+	if _, err := LazyFilePath(settings, "a", "page"); err == nil {
+		t.Error("expected an error for a uuid shorter than the layout slice")
+	}
+	for _, layout := range []string{"{page}.xml", "{uuid}/{name}.xml", "/{uuid}/{page}.xml"} {
+		if err := ValidateFileLayout(layout); err == nil {
+			t.Errorf("expected layout %q to be invalid", layout)
+		}
+	}
+}
+
+func TestFileItemMatcher(t *testing.T) {
+	settings := model.Configuration{XmlFileLocation: "/var/ocr_files", LazyFileLayout: "{uuid[0:2]}/{uuid}/{page}.xml"}
+	fileItem, err := FileItemMatcher(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]bool{
+		"/var/ocr_files/41/" + layoutUuid + "/page_1.xml": true,
+		"/var/ocr_files/42/" + layoutUuid + "/page_1.xml": false,
+		"/var/ocr_files/41/" + layoutUuid + "/page_1.txt": false,
+		"/var/ocr_files/41/notes/page_1.xml":              false,
+		"/var/other/41/" + layoutUuid + "/page_1.xml":     false,
+	}
+	for path, expected := range tests {
+		uuid, ok := fileItem(path)
+		if ok != expected || (ok && uuid != layoutUuid) {
+			t.Errorf("fileItem(%q) = %q, %t, expected %t", path, uuid, ok, expected)
+		}
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	dir := t.TempDir()
+	flat := filepath.Join(dir, layoutUuid+"-page1.xml")
+	if err := ioutil.WriteFile(flat, []byte("<ocr/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var updates []string
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/select") {
+			_, _ = fmt.Fprintf(w, `{"response":{"numFound":1,"docs":[{"id":"%s-page1",
+"manifest_url":"%s/iiif/%s/manifest","ocr_text":"%s{ascii}"}]},"nextCursorMark":"*"}`,
+				layoutUuid, server.URL, layoutUuid, flat)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		updates = append(updates, string(body))
+		_, _ = fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	settings := model.Configuration{SolrUrl: server.URL, SolrCore: "core", ManifestBase: server.URL,
+		XmlFileLocation: dir, LazyFileLayout: "{uuid[0:2]}/{uuid}/{page}.xml"}
+	result, err := MigrateFiles(settings, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "41", layoutUuid, "page1.xml")
+	if result.Moved != 1 || len(result.Errors) != 0 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Errorf("expected the file to be moved to %s: %v", target, err)
+	}
+	expected := fmt.Sprintf(`[{"id":"%s-page1","ocr_text":{"set":"%s{ascii}"}}]`, layoutUuid, target)
+	if len(updates) != 2 || strings.TrimSpace(updates[0]) != expected {
+		t.Errorf("unexpected solr updates: %v", updates)
+	}
+	files, err := itemFiles(settings, layoutUuid)
+	if err != nil || len(files) != 1 || files[0] != target {
+		t.Errorf("unexpected item files: %v %v", files, err)
+	}
+}
@@ -0,0 +1,64 @@
+package process
+
+import (
+	"errors"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/storage"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// fileKey returns the storage key of a lazy loaded OCR file, which is the path relative to the
+// xml_file_location.
+func fileKey(settings model.Configuration, path string) (string, error) {
+	root := filepath.Clean(settings.XmlFileLocation)
+	rel, err := filepath.Rel(root, filepath.Clean(strings.Replace(path, "{ascii}", "", 1)))
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("lazy file path is outside of xml_file_location: " + path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// filePath returns the path of the lazy loaded OCR file with the storage key.
+func filePath(settings model.Configuration, key string) string {
+	return filepath.Join(filepath.Clean(settings.XmlFileLocation), filepath.FromSlash(key))
+}
+
+// writeLazyFile stores the lazy loaded OCR file.
+func writeLazyFile(settings model.Configuration, path string, content []byte) error {
+	store, err := storage.New(settings)
+	if err != nil {
+		return err
+	}
+	key, err := fileKey(settings, path)
+	if err != nil {
+		return err
+	}
+	return store.Write(key, content)
+}
+
+// FileExists returns true if the lazy loaded OCR file is stored. Files outside of the xml_file_location
+// are not stored.
+func FileExists(settings model.Configuration, path string) (bool, error) {
+	store, err := storage.New(settings)
+	if err != nil {
+		return false, err
+	}
+	key, err := fileKey(settings, path)
+	if err != nil {
+		return false, nil
+	}
+	return store.Exists(key)
+}
+
+// ListFiles calls visit with the path and modification time of each stored lazy loaded OCR file.
+func ListFiles(settings model.Configuration, visit func(path string, modified time.Time) error) error {
+	store, err := storage.New(settings)
+	if err != nil {
+		return err
+	}
+	return store.List("", func(object storage.Object) error {
+		return visit(filePath(settings, object.Key), object.Modified)
+	})
+}
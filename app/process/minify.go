@@ -0,0 +1,32 @@
+package process
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Lazy file compression settings.
+const (
+	NoCompression = "none"
+	Minify        = "minify"
+)
+
+var (
+	xmlComment    = regexp.MustCompile(`<!--[\s\S]*?-->`)
+	tagWhitespace = regexp.MustCompile(`>\s+<`)
+)
+
+// minifyOcr reduces the size of an OCR file by removing comments and whitespace between elements.
+// In ALTO files the whitespace between elements is removed. hOCR and MiniOCR words can be separated only
+// by whitespace, so there the whitespace is replaced with a single space.
+func minifyOcr(ocr string) string {
+	sample := ocr
+	if len(sample) > 1200 {
+		sample = sample[:1200]
+	}
+	ocr = strings.TrimSpace(xmlComment.ReplaceAllString(ocr, ""))
+	if GetOcrFormat(sample) == AltoFormat {
+		return tagWhitespace.ReplaceAllString(ocr, "><")
+	}
+	return tagWhitespace.ReplaceAllString(ocr, "> <")
+}
@@ -0,0 +1,26 @@
+package process
+
+import "testing"
+
+func TestMinifyOcr(t *testing.T) {
+	alto := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- generated -->
+<alto xmlns="http://www.loc.gov/standards/alto/ns-v3#">
+  <Layout>
+    <String CONTENT="Hello"/>
+    <SP/>
+    <String CONTENT="world"/>
+  </Layout>
+</alto>
+`
+	expected := `<?xml version="1.0" encoding="UTF-8"?><alto xmlns="http://www.loc.gov/standards/alto/ns-v3#">` +
+		`<Layout><String CONTENT="Hello"/><SP/><String CONTENT="world"/></Layout></alto>`
+	if minified := minifyOcr(alto); minified != expected {
+		t.Errorf("unexpected ALTO:\n%s", minified)
+	}
+	miniOcr := "<ocr>\n  <p>\n    <w x=\"1 2 3 4\">Hello</w>\n    <w x=\"5 6 7 8\">world</w>\n  </p>\n</ocr>"
+	expected = `<ocr> <p> <w x="1 2 3 4">Hello</w> <w x="5 6 7 8">world</w> </p> </ocr>`
+	if minified := minifyOcr(miniOcr); minified != expected {
+		t.Errorf("expected words to stay separated:\n%s", minified)
+	}
+}
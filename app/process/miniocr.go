@@ -4,27 +4,30 @@ import (
 	"bytes"
 	"encoding/xml"
 	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	"github.com/mspalti/ocrprocessor/model"
 	"io"
-	"log"
 	"strconv"
+	"time"
 )
 
-func (processor MiniOcrProcessor) ProcessOcr(uuid *string, fileName string, ocr *[]byte, position int,
-	manifestId string, settings model.Configuration, log *log.Logger) error {
-
-	miniOcr, err := updateXml(ocr, position, settings)
+func (processor MiniOcrProcessor) ProcessOcr(page model.OcrPage, ocr *[]byte, settings model.Configuration,
+	log *logging.Logger) error {
+	start := time.Now()
+	miniOcr, err := updateXml(ocr, page.Position, settings)
 	if err != nil {
 		return err
 	}
+	metrics.ConversionSeconds.ObserveDuration(start, MiniocrFormat.String())
 
-	if settings.IndexType == "full" {
-		var err = PostToSolr(uuid, fileName, miniOcr, manifestId, settings, log)
+	if settings.IndexType == FullIndex {
+		var err = PostToSolr(page, miniOcr, settings, log)
 		if err != nil {
 			return errors.New("MiniOcr indexing failed: " + err.Error())
 		}
 	} else {
-		var err = PostToSolrLazyLoad(uuid, fileName, miniOcr, manifestId, settings, log)
+		var err = PostToSolrLazyLoad(page, miniOcr, settings, log)
 		if err != nil {
 			return errors.New("MiniOcr indexing failed: " + err.Error())
 		}
@@ -48,8 +51,7 @@ func updateXml(ocr *[]byte, position int, settings model.Configuration) (*string
 			break
 		}
 		if err != nil {
-			log.Printf("error getting token: %t\n", err)
-			return nil, err
+			return nil, errors.New("error getting token: " + err.Error())
 		}
 		switch t := token.(type) {
 		case xml.CharData:
@@ -65,7 +67,7 @@ func updateXml(ocr *[]byte, position int, settings model.Configuration) (*string
 			}
 		case xml.StartElement:
 			if t.Name.Local == "w" {
-				if settings.EscapeUtf8 && settings.IndexType == "lazy" {
+				if settings.EscapeUtf8 && settings.IndexType == LazyIndex {
 					xmlEncodeWord = true
 				}
 				if err = encoder.EncodeToken(t); err != nil {
@@ -1,14 +1,13 @@
 package process
 
 import (
+	"github.com/mspalti/ocrprocessor/logging"
 	"github.com/mspalti/ocrprocessor/model"
-	"log"
 )
 
 type OcrProcessor interface {
 	// ProcessOcr implements transformations and loading of OCR files.
-	ProcessOcr(uuid *string, fileName string, alto *[]byte, position int,
-		manifestId string, settings model.Configuration, log *log.Logger) error
+	ProcessOcr(page model.OcrPage, ocr *[]byte, settings model.Configuration, log *logging.Logger) error
 }
 
 type AltoProcessor struct{}
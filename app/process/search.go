@@ -0,0 +1,122 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxSearchResults limits the number of page documents returned for a search within an Item.
+const maxSearchResults = 1000
+
+// maxSnippets limits the number of highlighted snippets returned for each page.
+const maxSnippets = 100
+
+var solrSpecialChars = strings.NewReplacer(`\`, `\\`, `+`, `\+`, `-`, `\-`, `&`, `\&`, `|`, `\|`, `!`, `\!`,
+	`(`, `\(`, `)`, `\)`, `{`, `\{`, `}`, `\}`, `[`, `\[`, `]`, `\]`, `^`, `\^`, `"`, `\"`, `~`, `\~`,
+	`*`, `\*`, `?`, `\?`, `:`, `\:`, `/`, `\/`)
+
+// SearchSolr queries the OCR field of the Item's documents and returns the solr-ocrhighlighting results.
+func SearchSolr(settings model.Configuration, uuid string, query string) (model.SolrHighlightResponse, error) {
+	fields := solrFields(settings)
+	params := url.Values{}
+	params.Set("q", fields.OcrText+":("+searchTerms(settings, query)+")")
+	params.Set("fq", manifestFilter(settings, uuid))
+	params.Set("fl", fields.Id)
+	params.Set("rows", strconv.Itoa(maxSearchResults))
+	params.Set("hl", "true")
+	params.Set("hl.ocr.fl", fields.OcrText)
+	params.Set("hl.snippets", strconv.Itoa(maxSnippets))
+	params.Set("hl.weightMatches", "true")
+	params.Set("hl.ocr.absoluteHighlights", "true")
+	params.Set("wt", "json")
+	if route := solrRoute(settings, uuid); len(route) > 0 {
+		params.Set("_route_", route)
+	}
+	solrResponse := model.SolrHighlightResponse{}
+	resp, err := solrRequest(settings, "GET", "select?"+params.Encode(), nil)
+	if err != nil {
+		return solrResponse, errors.New("could not search solr: " + err.Error())
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(&solrResponse)
+	return solrResponse, err
+}
+
+// SuggestTerms returns indexed terms of the Item's documents that begin with the prefix.
+func SuggestTerms(settings model.Configuration, uuid string, prefix string, limit int) ([]model.TermCount, error) {
+	fields := solrFields(settings)
+	params := url.Values{}
+	params.Set("q", "*:*")
+	params.Set("fq", manifestFilter(settings, uuid))
+	params.Set("rows", "0")
+	params.Set("facet", "true")
+	params.Set("facet.field", fields.OcrText)
+	params.Set("facet.prefix", strings.ToLower(encodeQuery(settings, prefix)))
+	params.Set("facet.limit", strconv.Itoa(limit))
+	params.Set("facet.mincount", "1")
+	params.Set("wt", "json")
+	if route := solrRoute(settings, uuid); len(route) > 0 {
+		params.Set("_route_", route)
+	}
+	resp, err := solrRequest(settings, "GET", "select?"+params.Encode(), nil)
+	if err != nil {
+		return nil, errors.New("could not query solr for terms: " + err.Error())
+	}
+	defer resp.Body.Close()
+	solrResponse := model.SolrHighlightResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&solrResponse); err != nil {
+		return nil, err
+	}
+	// Solr returns facets as a flat list of term and count pairs.
+	facets := solrResponse.FacetCounts.FacetFields[fields.OcrText]
+	terms := make([]model.TermCount, 0, len(facets)/2)
+	for i := 0; i+1 < len(facets); i += 2 {
+		term, ok := facets[i].(string)
+		count, isNumber := facets[i+1].(float64)
+		if ok && isNumber {
+			terms = append(terms, model.TermCount{Term: term, Count: int(count)})
+		}
+	}
+	return terms, nil
+}
+
+// PageIndex returns the position of the OCR page from its identifier (e.g. 3 for Page.3).
+func PageIndex(ocrPageId string) (int, error) {
+	if !strings.HasPrefix(ocrPageId, "Page.") {
+		return -1, fmt.Errorf("unexpected OCR page identifier: %s", ocrPageId)
+	}
+	return strconv.Atoi(strings.TrimPrefix(ocrPageId, "Page."))
+}
+
+// ManifestUrl returns the manifest identifier used for the Item in the Solr index.
+func ManifestUrl(settings model.Configuration, uuid string) string {
+	return getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
+}
+
+// manifestFilter returns the Solr filter query for the Item's documents.
+func manifestFilter(settings model.Configuration, uuid string) string {
+	return solrFields(settings).ManifestUrl + ":\"" + ManifestUrl(settings, uuid) + "\""
+}
+
+// searchTerms escapes the terms of the user query for the Solr query parser.
+func searchTerms(settings model.Configuration, query string) string {
+	terms := strings.Fields(encodeQuery(settings, query))
+	for i := range terms {
+		terms[i] = solrSpecialChars.Replace(terms[i])
+	}
+	return strings.Join(terms, " ")
+}
+
+// encodeQuery converts unicode characters to XML-encoded code points if the OCR files were
+// indexed with escaped characters.
+func encodeQuery(settings model.Configuration, query string) string {
+	if settings.EscapeUtf8 && settings.IndexType == LazyIndex {
+		return ToXmlCodePoint(query)
+	}
+	return query
+}
@@ -6,34 +6,34 @@ import (
 	"errors"
 	"fmt"
 	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
 	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/storage"
 	"io"
-	"io/ioutil"
-	"log"
-	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 // DeleteFromSolr removes all entries from the solr index for a uuid and (if lazy) removes ocr files from disk.
 func DeleteFromSolr(settings model.Configuration, uuid string) error {
 	manifestUrl := getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
-	var files []model.Docs
+	var files []string
 	var fileError error
-	if settings.IndexType == "lazy" {
-		files, fileError = getFiles(settings, manifestUrl)
+	if settings.IndexType == LazyIndex {
+		files, fileError = getFiles(settings, uuid, manifestUrl)
 		if fileError != nil {
 			return fileError
 		}
 	}
-	err := deleteSolrEntries(settings, manifestUrl)
+	err := deleteSolrEntries(settings, uuid, manifestUrl)
 	if err != nil {
 		return err
 	}
-	if settings.IndexType == "lazy" {
-		err = deleteFiles(files)
+	if settings.IndexType == LazyIndex {
+		err = deleteFiles(settings, files)
 		if err != nil {
 			return err
 		}
@@ -42,20 +42,43 @@ func DeleteFromSolr(settings model.Configuration, uuid string) error {
 	return nil
 }
 
+// RollbackItem removes the index entries and (if lazy) the ocr files written for an item whose processing
+// did not complete. Unlike DeleteFromSolr, files are found by name since the entries may not be committed.
+func RollbackItem(settings model.Configuration, uuid string) error {
+	manifestUrl := getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
+	if err := deleteSolrEntries(settings, uuid, manifestUrl); err != nil {
+		return err
+	}
+	if settings.IndexType == LazyIndex {
+		files, err := itemFiles(settings, uuid)
+		if err != nil {
+			return err
+		}
+		return deleteFiles(settings, files)
+	}
+	return nil
+}
+
+// CommitSolr commits pending updates to the solr index.
+func CommitSolr(settings model.Configuration) error {
+	resp, err := solrRequest(settings, "POST", "update?commit=true", strings.NewReader("{}"))
+	if err != nil {
+		return errors.New("could not commit solr updates: " + err.Error())
+	}
+	defer resp.Body.Close()
+	return nil
+}
+
 // deleteSolrEntries removes all ocr entries for a manifest from the solr index
-func deleteSolrEntries(settings model.Configuration, manifestUrl string) error {
-	deleteEndPoint := fmt.Sprintf("%s/%s/update?", settings.SolrUrl, settings.SolrCore)
+func deleteSolrEntries(settings model.Configuration, uuid string, manifestUrl string) error {
 	deleteByManifest := url.QueryEscape("\"" + manifestUrl + "\"")
-	deleteBody := "manifest_url:" + deleteByManifest
+	deleteBody := solrFields(settings).ManifestUrl + ":" + deleteByManifest
 	solrPostBody := &model.SolrDeletePost{
 		Delete: model.Delete{Query: deleteBody},
 	}
 	payloadBuf := new(bytes.Buffer)
 	json.NewEncoder(payloadBuf).Encode(solrPostBody)
-	req, err := http.NewRequest("POST", deleteEndPoint, payloadBuf)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := solrRequest(settings, "POST", "update?"+routeParam(settings, uuid), payloadBuf)
 	if err != nil {
 		return errors.New("could not delete solr file: " + err.Error())
 	}
@@ -64,49 +87,49 @@ func deleteSolrEntries(settings model.Configuration, manifestUrl string) error {
 	return nil
 }
 
-// getFiles returns the indexed ocr file pointers for the manifest (limit 600 files)
-func getFiles(settings model.Configuration, manifestUrl string) ([]model.Docs, error) {
-	solrUrl := fmt.Sprintf("%s/%s/select?fl=ocr_text&rows=600&q=manifest_url:%s",
-		settings.SolrUrl, settings.SolrCore, url.QueryEscape("\""+manifestUrl+"\""))
-	payloadBuf := new(bytes.Buffer)
-	req, err := http.NewRequest("GET", solrUrl, payloadBuf)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// getFiles returns the indexed ocr file pointers for the manifest
+func getFiles(settings model.Configuration, uuid string, manifestUrl string) ([]string, error) {
+	fields := solrFields(settings)
+	docs, err := getItemDocs(settings, uuid, manifestUrl, fields.OcrText)
 	if err != nil {
 		return nil, errors.New("could not query solr for files to delete: " + err.Error())
 	}
-	defer resp.Body.Close()
-	solrResponse := model.SolrResponse{}
-	err = json.NewDecoder(resp.Body).Decode(&solrResponse)
-	files := solrResponse.Response.Docs
+	files := make([]string, 0, len(docs))
+	for _, doc := range docs {
+		if path := doc.String(fields.OcrText); isFilePath(path) {
+			files = append(files, path)
+		}
+	}
 	return files, nil
 }
 
-// deleteFiles removes the ocr files on disk
-func deleteFiles(files []model.Docs) error {
-	for i := 0; i < len(files); i++ {
-		file := files[i].OcrText
-		file = strings.Replace(file, "{ascii}", "", 1)
-		err := os.Remove(file)
-		if err != nil {
-			return err
+// deleteFiles removes the ocr files from storage. Files that do not exist are ignored, and the remaining
+// files are removed when a file cannot be removed. The first error is returned.
+func deleteFiles(settings model.Configuration, files []string) error {
+	store, err := storage.New(settings)
+	if err != nil {
+		return err
+	}
+	var firstErr error
+	for _, file := range files {
+		key, err := fileKey(settings, file)
+		if err == nil {
+			err = store.Remove(key)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-	return nil
+	return firstErr
 }
 
 // CheckSolr returns true if the index has entries for the uuid
 func CheckSolr(settings model.Configuration, uuid string) (bool, error) {
 	manifestUrl := getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
-	solrUrl := fmt.Sprintf("%s/%s/select?fl=manifest_url&q=manifest_url:%s",
-		settings.SolrUrl, settings.SolrCore, "\""+manifestUrl+"\"")
-	payloadBuf := new(bytes.Buffer)
-	req, err := http.NewRequest("GET", solrUrl, payloadBuf)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	fields := solrFields(settings)
+	query := fmt.Sprintf("select?fl=%s&q=%s:%s%s", fields.ManifestUrl, fields.ManifestUrl,
+		url.QueryEscape("\""+manifestUrl+"\""), routeParam(settings, uuid))
+	resp, err := solrRequest(settings, "GET", query, nil)
 	if err != nil {
 		return false, errors.New("could not query solr: " + err.Error())
 	}
@@ -124,79 +147,160 @@ func CheckSolr(settings model.Configuration, uuid string) (bool, error) {
 }
 
 // PostToSolrLazyLoad adds to solr index and writes alto file to disk. Alto file will be lazy loaded by the solr plugin
-func PostToSolrLazyLoad(uuid *string, fileName string, altoFile *string, manifestId string,
-	settings model.Configuration, log *log.Logger) error {
-	var extension = filepath.Ext(fileName)
-	solrId := *uuid + "-" + fileName[0:len(fileName)-len(extension)]
-	path := settings.XmlFileLocation + "/" + solrId + ".xml"
-	err2 := ioutil.WriteFile(path, []byte(*altoFile), 0644)
-	if err2 != nil {
+func PostToSolrLazyLoad(page model.OcrPage, altoFile *string, settings model.Configuration, log *logging.Logger) error {
+	path, err := LazyFilePath(settings, page.Uuid, PageName(page.FileName))
+	if err != nil {
+		return err
+	}
+	content := *altoFile
+	if settings.LazyFileCompression == Minify {
+		content = minifyOcr(content)
+	}
+	if err := writeLazyFile(settings, path, []byte(content)); err != nil {
+		log.Error("Unable to write OCR file.", logging.F("path", path), logging.Err(err))
 		return errors.New("could not write escaped alto file")
 	}
+	metrics.FileBytesWritten.Add(float64(len(content)))
+	metrics.FileBytesSaved.Add(float64(len(*altoFile) - len(content)))
+	if page.FileSize != nil {
+		*page.FileSize = model.FileSize{Original: int64(len(*altoFile)), Written: int64(len(content))}
+	}
+	// Solr reads the file from the path when the document is posted, so with s3 storage the xml_file_location
+	// must be a mount of the bucket on the Solr host
 	if settings.EscapeUtf8 {
 		path = path + "{ascii}"
 	}
-	solrPostBody := &model.SolrCreatePost{
-		Id:          solrId,
-		ManifestUrl: manifestId,
-		OcrText:     path}
+	solrPostBody := solrDocument(page, path, settings)
 
 	payloadBuf := new(bytes.Buffer)
 	json.NewEncoder(payloadBuf).Encode(solrPostBody)
-	solrUrl := fmt.Sprintf("%s/%s/update/json/docs", settings.SolrUrl, settings.SolrCore)
-
-	req, err := http.NewRequest("POST", solrUrl, payloadBuf)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := solrRequest(settings, "POST", "update/json/docs", payloadBuf)
 	if err != nil {
-		log.Println(err.Error())
+		log.Error("Solr update failed", logging.Err(err))
 		return UnProcessableEntity{CAUSE: "Solr update problem. See log."}
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close Solr response.")
+			log.Warn("Unable to close Solr response.")
 		}
 	}(resp.Body)
-	if settings.VerboseLogging {
-		log.Printf("Added %s to Solr index", *uuid)
-	}
+	log.Debug("Added page to Solr index")
 	return nil
 
 }
 
 // PostToSolr add the miniOcr content directly to the solr index. No lazy loading.
-func PostToSolr(uuid *string, fileName string, miniOcr *string, manifestId string,
-	settings model.Configuration, log *log.Logger) error {
-	var extension = filepath.Ext(fileName)
-	solrId := *uuid + "-" + fileName[0:len(fileName)-len(extension)]
-	solrPayload := &model.SolrCreatePost{
-		Id:          solrId,
-		ManifestUrl: manifestId,
-		OcrText:     *miniOcr}
+func PostToSolr(page model.OcrPage, miniOcr *string, settings model.Configuration, log *logging.Logger) error {
+	solrPayload := solrDocument(page, *miniOcr, settings)
 	payloadBuf := new(bytes.Buffer)
 	enc := json.NewEncoder(payloadBuf)
 	enc.SetEscapeHTML(false)
 	enc.Encode(solrPayload)
-	solrUrl := fmt.Sprintf("%s/%s/update/json/docs", settings.SolrUrl, settings.SolrCore)
-	req, err := http.NewRequest("POST", solrUrl, payloadBuf)
-	req.Header.Set("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := solrRequest(settings, "POST", "update/json/docs", payloadBuf)
 	if err != nil {
-		log.Println(err.Error())
+		log.Error("Solr update failed", logging.Err(err))
 		return UnProcessableEntity{CAUSE: "Solr update problem. See log."}
 	}
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			log.Printf("Unable to close Solr response.")
+			log.Warn("Unable to close Solr response.")
 		}
 	}(resp.Body)
-	if settings.VerboseLogging {
-		log.Printf("Added %s to Solr index", *uuid)
-	}
+	log.Debug("Added page to Solr index")
 	return nil
 }
+
+// pageId returns the identifier for the OCR page, based on the item uuid and the OCR file name.
+func pageId(page model.OcrPage) string {
+	return page.Uuid + "-" + PageName(page.FileName)
+}
+
+// SolrId returns the Solr document id of the OCR page, which has the route prefix of the item if
+// documents are routed by item.
+func SolrId(settings model.Configuration, page model.OcrPage) string {
+	return solrRoute(settings, page.Uuid) + pageId(page)
+}
+
+// PageName returns the page part of the page identifier, which is the OCR file name without extension.
+func PageName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+// solrFields returns the configured Solr field names, using the default field names of the
+// solr-ocrhighlighting example schema for required fields that are not configured.
+func solrFields(settings model.Configuration) model.SolrFields {
+	fields := settings.SolrFields
+	if len(fields.Id) == 0 {
+		fields.Id = "id"
+	}
+	if len(fields.ManifestUrl) == 0 {
+		fields.ManifestUrl = "manifest_url"
+	}
+	if len(fields.OcrText) == 0 {
+		fields.OcrText = "ocr_text"
+	}
+	return fields
+}
+
+// conversion describes the format conversion applied to the OCR page, e.g. alto-to-miniocr, or none.
+func conversion(page model.OcrPage, settings model.Configuration) string {
+	if settings.ConvertToMiniOcr && (page.Format == AltoFormat.String() || page.Format == HocrFormat.String()) {
+		return page.Format + "-to-miniocr"
+	}
+	return "none"
+}
+
+// solrDocument creates the Solr document for the OCR page. The ocrText is either the OCR content
+// or the path to the OCR file when lazy loading. Optional fields are added from the IIIF manifest
+// when configured.
+func solrDocument(page model.OcrPage, ocrText string, settings model.Configuration) model.SolrCreatePost {
+	fields := solrFields(settings)
+	doc := model.SolrCreatePost{
+		fields.Id:          SolrId(settings, page),
+		fields.ManifestUrl: page.Manifest.Id,
+		fields.OcrText:     ocrText,
+	}
+	if len(fields.Title) > 0 && len(page.Manifest.Label) > 0 {
+		doc[fields.Title] = page.Manifest.Label
+	}
+	if canvas := page.Manifest.Canvas(page.Position); canvas != nil {
+		if len(fields.PageLabel) > 0 && len(canvas.Label) > 0 {
+			doc[fields.PageLabel] = canvas.Label
+		}
+		if len(fields.CanvasId) > 0 {
+			doc[fields.CanvasId] = canvas.Id
+		}
+	}
+	if len(fields.IndexedAt) > 0 {
+		doc[fields.IndexedAt] = time.Now().UTC().Format(time.RFC3339)
+	}
+	if len(fields.SourceUrl) > 0 && len(page.SourceUrl) > 0 {
+		doc[fields.SourceUrl] = page.SourceUrl
+	}
+	if len(fields.SourceChecksum) > 0 && len(page.Checksum) > 0 {
+		doc[fields.SourceChecksum] = page.Checksum
+	}
+	if len(fields.Position) > 0 {
+		doc[fields.Position] = page.Position
+	}
+	if len(fields.SourceFormat) > 0 && len(page.Format) > 0 {
+		doc[fields.SourceFormat] = page.Format
+	}
+	if len(fields.Conversion) > 0 {
+		doc[fields.Conversion] = conversion(page, settings)
+	}
+	if len(fields.EscapeUtf8) > 0 {
+		doc[fields.EscapeUtf8] = settings.EscapeUtf8 && settings.IndexType == LazyIndex
+	}
+	if len(fields.ProcessorVersion) > 0 {
+		doc[fields.ProcessorVersion] = Version
+	}
+	for _, metadata := range settings.MetadataFields {
+		if values := page.Manifest.Values(metadata.Label); len(values) > 0 {
+			doc[metadata.Field] = values
+		}
+	}
+	return doc
+}
@@ -0,0 +1,169 @@
+package process
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/metrics"
+	"github.com/mspalti/ocrprocessor/model"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// solrClient is a shared client and the latest modification time of its TLS files when it was created.
+type solrClient struct {
+	client   *http.Client
+	modified time.Time
+}
+
+var solrClients = struct {
+	sync.Mutex
+	clients map[string]*solrClient
+}{clients: make(map[string]*solrClient)}
+
+// getSolrClient returns the http client for the Solr TLS configuration. Clients are shared so
+// that connections to Solr are reused. The client is created again when the CA bundle or client
+// certificate files are replaced, e.g. by certificate rotation. If the new files cannot be loaded
+// the previous client is used until they can.
+func getSolrClient(settings model.Configuration) (*http.Client, error) {
+	files := []string{settings.SolrCaFile, settings.SolrClientCert, settings.SolrClientKey}
+	key := strings.Join(files, "|")
+	modified := lastModified(files)
+	solrClients.Lock()
+	defer solrClients.Unlock()
+	cached, ok := solrClients.clients[key]
+	if ok && !modified.After(cached.modified) {
+		return cached.client, nil
+	}
+	tlsConfig, err := solrTlsConfig(settings)
+	if err != nil {
+		if ok {
+			return cached.client, nil
+		}
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	client := &http.Client{Transport: transport}
+	if ok {
+		cached.client.CloseIdleConnections()
+	}
+	solrClients.clients[key] = &solrClient{client: client, modified: modified}
+	return client, nil
+}
+
+// lastModified returns the latest modification time of the files that exist.
+func lastModified(files []string) time.Time {
+	var modified time.Time
+	for _, file := range files {
+		if len(file) == 0 {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified
+}
+
+// solrTlsConfig creates the TLS configuration with the custom CA bundle and client certificate.
+func solrTlsConfig(settings model.Configuration) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(settings.SolrCaFile) > 0 {
+		pem, err := ioutil.ReadFile(settings.SolrCaFile)
+		if err != nil {
+			return nil, errors.New("could not read solr CA file: " + err.Error())
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in solr CA file: " + settings.SolrCaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(settings.SolrClientCert) > 0 || len(settings.SolrClientKey) > 0 {
+		cert, err := tls.LoadX509KeyPair(settings.SolrClientCert, settings.SolrClientKey)
+		if err != nil {
+			return nil, errors.New("could not load solr client certificate: " + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// solrEndpoint returns the URL for a request handler path of the configured Solr core or collection.
+func solrEndpoint(baseUrl string, settings model.Configuration, path string) string {
+	return fmt.Sprintf("%s/%s/%s", baseUrl, settings.SolrCore, path)
+}
+
+// setSolrAuthorization adds the configured Solr credentials to the request.
+func setSolrAuthorization(req *http.Request, settings model.Configuration) {
+	if len(settings.SolrToken) > 0 {
+		req.Header.Set("Authorization", "Bearer "+settings.SolrToken)
+	} else if len(settings.SolrUsername) > 0 {
+		req.SetBasicAuth(settings.SolrUsername, settings.SolrPassword)
+	}
+}
+
+// solrRequest sends a request to the configured Solr core using the Solr credentials and
+// TLS settings. If a node cannot be reached or responds with a server error the request is
+// retried on the next available node. An error is returned if no node responds with a
+// success status.
+func solrRequest(settings model.Configuration, method string, path string, body io.Reader) (*http.Response, error) {
+	client, err := getSolrClient(settings)
+	if err != nil {
+		return nil, err
+	}
+	var payload []byte
+	if body != nil {
+		payload, err = ioutil.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	endpoint := solrHandlerName(path)
+	cluster := getSolrCluster(settings)
+	lastError := errors.New("no solr nodes configured")
+	for _, node := range cluster.nodes(settings, client) {
+		req, err := http.NewRequest(method, solrEndpoint(node, settings, path), bytes.NewReader(payload))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		setSolrAuthorization(req, settings)
+		start := time.Now()
+		resp, err := client.Do(req)
+		metrics.SolrRequestSeconds.ObserveDuration(start, endpoint)
+		metrics.SolrRequests.Inc(endpoint, metrics.StatusCode(resp, err))
+		if err != nil {
+			lastError = err
+			continue
+		}
+		if resp.StatusCode >= 500 {
+			_ = resp.Body.Close()
+			lastError = errors.New("solr request failed. Status: " + resp.Status)
+			continue
+		}
+		cluster.succeeded(node)
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			_ = resp.Body.Close()
+			return nil, errors.New("solr request failed. Status: " + resp.Status)
+		}
+		return resp, nil
+	}
+	return nil, lastError
+}
+
+// solrHandlerName returns the request handler path without the query, used as the metrics label.
+func solrHandlerName(path string) string {
+	return strings.SplitN(path, "?", 2)[0]
+}
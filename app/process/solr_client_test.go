@@ -0,0 +1,108 @@
+package process
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSolrRequestWithBasicAuthAndCustomCa(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "solr" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path != "/solr/core/select" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"response":{"numFound":1}}`))
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, caPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	settings := model.Configuration{
+		SolrUrl:      server.URL + "/solr",
+		SolrCore:     "core",
+		SolrUsername: "solr",
+		SolrPassword: "secret",
+		SolrCaFile:   caFile,
+	}
+	exists, err := CheckSolr(settings, "1234")
+	if err != nil {
+		t.Fatalf("expected authenticated TLS request to succeed: %s", err.Error())
+	}
+	if !exists {
+		t.Errorf("expected item to be found")
+	}
+
+	settings.SolrPassword = "wrong"
+	if _, err := CheckSolr(settings, "1234"); err == nil {
+		t.Errorf("expected error for rejected credentials")
+	}
+}
+
+func TestSolrClientReloadsRotatedCa(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeCa := func(der []byte, modified time.Time) {
+		caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if err := ioutil.WriteFile(caFile, caPem, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(caFile, modified, modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := model.Configuration{SolrCaFile: caFile}
+	get := func() error {
+		client, err := getSolrClient(settings)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+
+	// a CA that did not issue the server certificate
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "other"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour), IsCA: true,
+		BasicConstraintsValid: true}
+	other, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeCa(other, time.Now().Add(-time.Hour))
+	if err := get(); err == nil {
+		t.Fatalf("expected the server certificate to be untrusted")
+	}
+	writeCa(server.Certificate().Raw, time.Now())
+	if err := get(); err != nil {
+		t.Errorf("expected the rotated CA to be trusted: %s", err.Error())
+	}
+}
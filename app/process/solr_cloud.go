@@ -0,0 +1,188 @@
+package process
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clusterRefreshInterval is the time between CLUSTERSTATUS requests used to discover live nodes.
+const clusterRefreshInterval = time.Minute
+
+// solrCluster tracks the Solr nodes that can receive requests. The configured base URLs are
+// always candidates. When SolrCloud discovery is enabled, live nodes reported by the
+// Collections API are tried first.
+type solrCluster struct {
+	mutex      sync.Mutex
+	configured []string
+	live       []string
+	current    string
+	refreshed  time.Time
+}
+
+// solrClusterStatus is the subset of the Collections API CLUSTERSTATUS response used for discovery.
+type solrClusterStatus struct {
+	Cluster struct {
+		LiveNodes   []string               `json:"live_nodes"`
+		Collections map[string]interface{} `json:"collections"`
+		Aliases     map[string]string      `json:"aliases"`
+	} `json:"cluster"`
+}
+
+var solrClusters = struct {
+	sync.Mutex
+	clusters map[string]*solrCluster
+}{clusters: make(map[string]*solrCluster)}
+
+// solrBaseUrls returns the configured Solr base URLs, falling back to the single solr_url setting.
+func solrBaseUrls(settings model.Configuration) []string {
+	if len(settings.SolrUrls) > 0 {
+		return settings.SolrUrls
+	}
+	return []string{settings.SolrUrl}
+}
+
+// getSolrCluster returns the shared node state for the configured Solr base URLs.
+func getSolrCluster(settings model.Configuration) *solrCluster {
+	urls := solrBaseUrls(settings)
+	key := strings.Join(urls, "|")
+	solrClusters.Lock()
+	defer solrClusters.Unlock()
+	cluster, ok := solrClusters.clusters[key]
+	if !ok {
+		cluster = &solrCluster{configured: urls, current: urls[0]}
+		solrClusters.clusters[key] = cluster
+	}
+	return cluster
+}
+
+// nodes returns the candidate base URLs, starting with the node that last succeeded.
+func (c *solrCluster) nodes(settings model.Configuration, client *http.Client) []string {
+	if settings.SolrCloud {
+		c.refresh(settings, client)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	nodes := []string{c.current}
+	for _, node := range append(append([]string{}, c.live...), c.configured...) {
+		if !contains(nodes, node) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// succeeded records the node that handled the last request.
+func (c *solrCluster) succeeded(node string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.current = node
+}
+
+// refresh updates the live nodes from the Collections API if the refresh interval has elapsed.
+// The configured nodes are tried in turn. If no node responds, the previous state is retained.
+func (c *solrCluster) refresh(settings model.Configuration, client *http.Client) {
+	c.mutex.Lock()
+	if time.Since(c.refreshed) < clusterRefreshInterval {
+		c.mutex.Unlock()
+		return
+	}
+	c.refreshed = time.Now()
+	configured := c.configured
+	c.mutex.Unlock()
+
+	for _, base := range configured {
+		live, err := clusterLiveNodes(base, settings, client)
+		if err != nil {
+			continue
+		}
+		c.mutex.Lock()
+		c.live = live
+		if !contains(live, c.current) && !contains(configured, c.current) && len(live) > 0 {
+			c.current = live[0]
+		}
+		c.mutex.Unlock()
+		return
+	}
+}
+
+// clusterLiveNodes requests CLUSTERSTATUS for the configured collection or alias and returns
+// the base URLs of the live nodes.
+func clusterLiveNodes(base string, settings model.Configuration, client *http.Client) ([]string, error) {
+	req, err := http.NewRequest("GET", base+"/admin/collections?action=CLUSTERSTATUS&wt=json", nil)
+	if err != nil {
+		return nil, err
+	}
+	setSolrAuthorization(req, settings)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("solr cluster status request failed. Status: " + resp.Status)
+	}
+	status := solrClusterStatus{}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+	_, isCollection := status.Cluster.Collections[settings.SolrCore]
+	_, isAlias := status.Cluster.Aliases[settings.SolrCore]
+	if !isCollection && !isAlias {
+		return nil, errors.New("solr collection or alias not found in cluster: " + settings.SolrCore)
+	}
+	baseUrl, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	live := make([]string, 0, len(status.Cluster.LiveNodes))
+	for _, node := range status.Cluster.LiveNodes {
+		live = append(live, liveNodeUrl(baseUrl.Scheme, node))
+	}
+	return live, nil
+}
+
+// liveNodeUrl converts a SolrCloud node name (e.g. "solr1:8983_solr") to a base URL.
+func liveNodeUrl(scheme string, node string) string {
+	hostAndContext := strings.SplitN(node, "_", 2)
+	nodeUrl := scheme + "://" + hostAndContext[0]
+	if len(hostAndContext) == 2 && len(hostAndContext[1]) > 0 {
+		context, err := url.PathUnescape(hostAndContext[1])
+		if err != nil {
+			context = hostAndContext[1]
+		}
+		nodeUrl += "/" + context
+	}
+	return nodeUrl
+}
+
+// solrRoute returns the compositeId route prefix for the item, or an empty string if documents
+// are not routed by item.
+func solrRoute(settings model.Configuration, uuid string) string {
+	if settings.SolrRouteByItem {
+		return uuid + "!"
+	}
+	return ""
+}
+
+// routeParam returns the _route_ query parameter for requests limited to the shard of the item.
+func routeParam(settings model.Configuration, uuid string) string {
+	if route := solrRoute(settings, uuid); len(route) > 0 {
+		return "&_route_=" + url.QueryEscape(route)
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package process
+
+import (
+	"github.com/mspalti/ocrprocessor/model"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSolrRequestFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	var route string
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route = r.URL.Query().Get("_route_")
+		_, _ = w.Write([]byte(`{"response":{"numFound":1}}`))
+	}))
+	defer up.Close()
+
+	settings := model.Configuration{
+		SolrUrls:        []string{down.URL + "/solr", up.URL + "/solr"},
+		SolrCore:        "alias",
+		SolrRouteByItem: true,
+	}
+	exists, err := CheckSolr(settings, "1234")
+	if err != nil {
+		t.Fatalf("expected request to fail over to the live node: %s", err.Error())
+	}
+	if !exists {
+		t.Errorf("expected item to be found")
+	}
+	if route != "1234!" {
+		t.Errorf("expected _route_ parameter for the item, got %q", route)
+	}
+	if current := getSolrCluster(settings).current; !strings.HasPrefix(current, up.URL) {
+		t.Errorf("expected live node to be used for subsequent requests, got %s", current)
+	}
+}
+
+func TestLiveNodeUrl(t *testing.T) {
+	if u := liveNodeUrl("https", "solr1:8983_solr"); u != "https://solr1:8983/solr" {
+		t.Errorf("unexpected node url: %s", u)
+	}
+	if u := liveNodeUrl("http", "10.0.0.1:8983_"); u != "http://10.0.0.1:8983" {
+		t.Errorf("unexpected node url: %s", u)
+	}
+}
@@ -0,0 +1,133 @@
+package process
+
+import (
+	"encoding/json"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testManifest = `{
+  "@id": "http://localhost:8080/server/iiif/1234/manifest",
+  "label": "Item title",
+  "metadata": [
+    {"label": "Date Issued", "value": "1901"},
+    {"label": "Language", "value": ["en", {"@value": "fr", "@language": "en"}]}
+  ],
+  "sequences": [{"canvases": [
+    {"@id": "http://localhost:8080/server/iiif/1234/canvas/c0", "label": "Page 1"},
+    {"@id": "http://localhost:8080/server/iiif/1234/canvas/c1", "label": "Page 2"}
+  ]}]
+}`
+
+func TestSolrDocument(t *testing.T) {
+	var manifest model.Manifest
+	if err := json.Unmarshal([]byte(testManifest), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	settings := model.Configuration{
+		SolrFields: model.SolrFields{OcrText: "ocr", Title: "title_s", PageLabel: "page_label_s",
+			CanvasId: "canvas_id_s"},
+		MetadataFields: []model.MetadataField{{Label: "language", Field: "language_ss"},
+			{Label: "Date Issued", Field: "date_ss"}, {Label: "Subject", Field: "subject_ss"}},
+	}
+	page := model.OcrPage{Uuid: "1234", FileName: "page2.xml", Position: 1, Manifest: &manifest}
+	doc := solrDocument(page, "<ocr/>", settings)
+	expected := model.SolrCreatePost{
+		"id":           "1234-page2",
+		"manifest_url": "http://localhost:8080/server/iiif/1234/manifest",
+		"ocr":          "<ocr/>",
+		"title_s":      "Item title",
+		"page_label_s": "Page 2",
+		"canvas_id_s":  "http://localhost:8080/server/iiif/1234/canvas/c1",
+		"language_ss":  []string{"en", "fr"},
+		"date_ss":      []string{"1901"},
+	}
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("unexpected solr document: %v", doc)
+	}
+}
+
+func TestSolrDocumentProvenance(t *testing.T) {
+	var manifest model.Manifest
+	if err := json.Unmarshal([]byte(testManifest), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	settings := model.Configuration{
+		IndexType:        "lazy",
+		EscapeUtf8:       true,
+		ConvertToMiniOcr: true,
+		SolrFields: model.SolrFields{IndexedAt: "indexed_at_dt", SourceUrl: "source_url_s",
+			SourceChecksum: "source_checksum_s", SourceFormat: "source_format_s", Conversion: "conversion_s",
+			EscapeUtf8: "escape_utf8_b", ProcessorVersion: "processor_version_s"},
+	}
+	page := model.OcrPage{Uuid: "1234", FileName: "page2.xml", Position: 1, Format: "hocr", Manifest: &manifest,
+		SourceUrl: "http://localhost:8080/server/api/core/bitstreams/5678/content", Checksum: "abc123"}
+	doc := solrDocument(page, "/var/ocr/1234-page2.xml", settings)
+	if _, err := time.Parse(time.RFC3339, doc["indexed_at_dt"].(string)); err != nil {
+		t.Errorf("expected indexing time: %v", doc["indexed_at_dt"])
+	}
+	expected := map[string]interface{}{
+		"source_url_s":        page.SourceUrl,
+		"source_checksum_s":   "abc123",
+		"source_format_s":     "hocr",
+		"conversion_s":        "hocr-to-miniocr",
+		"escape_utf8_b":       true,
+		"processor_version_s": Version,
+	}
+	for field, value := range expected {
+		if doc[field] != value {
+			t.Errorf("expected %v for %s, got %v", value, field, doc[field])
+		}
+	}
+}
+
+func TestRollbackItem(t *testing.T) {
+	var deleteQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var post model.SolrDeletePost
+		_ = json.NewDecoder(r.Body).Decode(&post)
+		deleteQuery = post.Delete.Query
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	for _, name := range []string{"1234-page1.xml", "1234-page2.xml", "5678-page1.xml"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("<ocr/>"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := model.Configuration{SolrUrl: server.URL, SolrCore: "core", IndexType: "lazy", XmlFileLocation: dir,
+		ManifestBase: "http://localhost/iiif/"}
+	if err := RollbackItem(settings, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(deleteQuery, "1234") {
+		t.Errorf("expected index entries for the item to be deleted, got %q", deleteQuery)
+	}
+	remaining, _ := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if len(remaining) != 1 || filepath.Base(remaining[0]) != "5678-page1.xml" {
+		t.Errorf("expected only the files of the item to be removed, got %v", remaining)
+	}
+}
+
+func TestDeleteFilesContinuesAfterMissingFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "1234-page2.xml")
+	if err := ioutil.WriteFile(existing, []byte("<ocr/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := deleteFiles(model.Configuration{XmlFileLocation: dir}, []string{filepath.Join(dir, "1234-page1.xml"), existing + "{ascii}"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(existing); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", existing)
+	}
+}
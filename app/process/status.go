@@ -0,0 +1,184 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/model"
+	"net/url"
+	"strings"
+)
+
+// solrPageSize is the number of documents requested from Solr at a time.
+const solrPageSize = 500
+
+// Index types of page documents.
+const (
+	FullIndex = "full"
+	LazyIndex = "lazy"
+)
+
+// ItemIndexStatus returns the page documents indexed for the item, sorted by Solr id. For lazy
+// documents the OCR file is checked on disk. The ocr_text field is only requested for lazy indexing,
+// since it holds the whole OCR page with full indexing, and documents are then reported as full.
+func ItemIndexStatus(settings model.Configuration, uuid string) (model.IndexStatus, error) {
+	fields := solrFields(settings)
+	manifestUrl := getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
+	ocrText := ""
+	if settings.IndexType == LazyIndex {
+		ocrText = fields.OcrText
+	}
+	docs, err := getItemDocs(settings, uuid, manifestUrl, fields.Id, ocrText, fields.IndexedAt,
+		fields.SourceUrl, fields.SourceChecksum, fields.SourceFormat, fields.Conversion, fields.ProcessorVersion)
+	if err != nil {
+		return model.IndexStatus{}, err
+	}
+	status := model.IndexStatus{Pages: len(docs), Documents: make([]model.IndexedPage, 0, len(docs))}
+	for _, doc := range docs {
+		page := model.IndexedPage{
+			SolrId:    doc.String(fields.Id),
+			IndexType: FullIndex,
+		}
+		page.PageId = documentPageId(page.SolrId, uuid)
+		if path := doc.String(ocrText); len(ocrText) > 0 && isFilePath(path) {
+			page.IndexType = LazyIndex
+			page.FilePath = strings.Replace(path, "{ascii}", "", 1)
+			exists, err := FileExists(settings, page.FilePath)
+			if err != nil {
+				return status, err
+			}
+			page.FileExists = &exists
+		}
+		page.IndexedAt = optionalString(doc, fields.IndexedAt)
+		// timestamps in the same RFC 3339 format sort chronologically
+		if page.IndexedAt > status.LastIndexed {
+			status.LastIndexed = page.IndexedAt
+		}
+		page.SourceUrl = optionalString(doc, fields.SourceUrl)
+		page.SourceChecksum = optionalString(doc, fields.SourceChecksum)
+		page.Format = optionalString(doc, fields.SourceFormat)
+		page.Conversion = optionalString(doc, fields.Conversion)
+		page.ProcessorVersion = optionalString(doc, fields.ProcessorVersion)
+		status.Documents = append(status.Documents, page)
+	}
+	return status, nil
+}
+
+// getItemDocs returns the requested fields of all page documents for the manifest, requesting
+// solrPageSize documents at a time.
+func getItemDocs(settings model.Configuration, uuid string, manifestUrl string, fl ...string) ([]model.SolrDoc, error) {
+	fields := solrFields(settings)
+	var names []string
+	for _, field := range fl {
+		if len(field) > 0 {
+			names = append(names, field)
+		}
+	}
+	var docs []model.SolrDoc
+	for {
+		query := fmt.Sprintf("select?fl=%s&q=%s:%s&sort=%s&rows=%d&start=%d%s",
+			url.QueryEscape(strings.Join(names, ",")), fields.ManifestUrl, url.QueryEscape("\""+manifestUrl+"\""),
+			url.QueryEscape(fields.Id+" asc"), solrPageSize, len(docs), routeParam(settings, uuid))
+		resp, err := solrRequest(settings, "GET", query, nil)
+		if err != nil {
+			return nil, errors.New("could not query solr: " + err.Error())
+		}
+		solrResponse := model.SolrResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&solrResponse)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, solrResponse.Response.Docs...)
+		if len(solrResponse.Response.Docs) == 0 || len(docs) >= solrResponse.Response.NumFound {
+			return docs, nil
+		}
+	}
+}
+
+// optionalString returns the value of an optional field, or an empty string if the field is not configured.
+func optionalString(doc model.SolrDoc, field string) string {
+	if len(field) == 0 {
+		return ""
+	}
+	return doc.String(field)
+}
+
+// documentPageId returns the page part of a Solr document id, without the route prefix and item uuid.
+func documentPageId(solrId string, uuid string) string {
+	id := solrId
+	if i := strings.Index(id, "!"); i >= 0 {
+		id = id[i+1:]
+	}
+	return strings.TrimPrefix(id, uuid+"-")
+}
+
+// isFilePath returns true if the ocr text field holds the path of a lazy loaded file rather than OCR content.
+func isFilePath(ocrText string) bool {
+	ocrText = strings.TrimSpace(ocrText)
+	return len(ocrText) > 0 && !strings.HasPrefix(ocrText, "<")
+}
+
+// PageState is the indexed state of an OCR page used for incremental indexing. Checksum and Position are
+// only available if the source_checksum and position fields are configured.
+type PageState struct {
+	SolrId      string
+	FilePath    string
+	Checksum    string
+	Position    int
+	HasPosition bool
+}
+
+// IndexedPages returns the indexed state of the item's pages keyed by page name.
+func IndexedPages(settings model.Configuration, uuid string) (map[string]PageState, error) {
+	fields := solrFields(settings)
+	manifestUrl := getDSpaceApiEndpoint(settings.ManifestBase, uuid, "manifest")
+	ocrText := ""
+	if settings.IndexType == LazyIndex {
+		ocrText = fields.OcrText
+	}
+	docs, err := getItemDocs(settings, uuid, manifestUrl, fields.Id, ocrText, fields.SourceChecksum, fields.Position)
+	if err != nil {
+		return nil, err
+	}
+	pages := make(map[string]PageState, len(docs))
+	for _, doc := range docs {
+		state := PageState{SolrId: doc.String(fields.Id), Checksum: optionalString(doc, fields.SourceChecksum)}
+		if len(ocrText) > 0 {
+			if path := doc.String(ocrText); isFilePath(path) {
+				state.FilePath = strings.Replace(path, "{ascii}", "", 1)
+			}
+		}
+		if len(fields.Position) > 0 {
+			state.Position, state.HasPosition = doc.Int(fields.Position)
+		}
+		pages[documentPageId(state.SolrId, uuid)] = state
+	}
+	return pages, nil
+}
+
+// DeletePages removes the page documents from the index and their files from disk.
+func DeletePages(settings model.Configuration, uuid string, pages []PageState) error {
+	if len(pages) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(pages))
+	var files []string
+	for _, page := range pages {
+		ids = append(ids, page.SolrId)
+		if len(page.FilePath) > 0 {
+			files = append(files, page.FilePath)
+		}
+	}
+	payloadBuf := new(bytes.Buffer)
+	if err := json.NewEncoder(payloadBuf).Encode(map[string][]string{"delete": ids}); err != nil {
+		return err
+	}
+	resp, err := solrRequest(settings, "POST", "update?"+routeParam(settings, uuid), payloadBuf)
+	if err != nil {
+		return errors.New("could not delete solr pages: " + err.Error())
+	}
+	resp.Body.Close()
+	return deleteFiles(settings, files)
+}
@@ -0,0 +1,84 @@
+package process
+
+import (
+	"fmt"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestItemIndexStatus(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "1234-page1.xml")
+	if err := ioutil.WriteFile(existing, []byte("<ocr/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	docs := []string{
+		fmt.Sprintf(`{"id":"1234-page1","ocr_text":"%s{ascii}","indexed_at_dt":"2026-01-02T10:00:00Z","format_s":"alto"}`, existing),
+		fmt.Sprintf(`{"id":"1234-page2","ocr_text":"%s","indexed_at_dt":"2026-01-03T10:00:00Z","format_s":"alto"}`,
+			filepath.Join(dir, "1234-page2.xml")),
+		`{"id":"1234-page3","ocr_text":"<ocr><p/></ocr>","indexed_at_dt":"2026-01-01T10:00:00Z","format_s":"hocr"}`,
+	}
+	var fl string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fl = r.URL.Query().Get("fl")
+		// return two documents at a time to verify paging
+		start := 0
+		_, _ = fmt.Sscanf(r.URL.Query().Get("start"), "%d", &start)
+		end := start + 2
+		if end > len(docs) {
+			end = len(docs)
+		}
+		page := ""
+		for i, doc := range docs[start:end] {
+			if i > 0 {
+				page += ","
+			}
+			page += doc
+		}
+		_, _ = fmt.Fprintf(w, `{"response":{"numFound":%d,"docs":[%s]}}`, len(docs), page)
+	}))
+	defer server.Close()
+
+	settings := model.Configuration{SolrUrl: server.URL, SolrCore: "core", XmlFileLocation: dir, IndexType: LazyIndex,
+		SolrFields: model.SolrFields{IndexedAt: "indexed_at_dt", SourceFormat: "format_s"}}
+	status, err := ItemIndexStatus(settings, "1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Pages != 3 || len(status.Documents) != 3 {
+		t.Fatalf("expected 3 documents, got %+v", status)
+	}
+	if status.LastIndexed != "2026-01-03T10:00:00Z" {
+		t.Errorf("unexpected last indexed time: %s", status.LastIndexed)
+	}
+	first, second, third := status.Documents[0], status.Documents[1], status.Documents[2]
+	if first.PageId != "page1" || first.IndexType != LazyIndex || first.FilePath != existing || !*first.FileExists {
+		t.Errorf("unexpected lazy document: %+v", first)
+	}
+	if second.FileExists == nil || *second.FileExists {
+		t.Errorf("expected missing lazy file to be reported: %+v", second)
+	}
+	if third.IndexType != FullIndex || third.FileExists != nil || third.Format != "hocr" {
+		t.Errorf("unexpected full document: %+v", third)
+	}
+
+	// the OCR pages are not retrieved with full indexing
+	settings.IndexType = FullIndex
+	if _, err := ItemIndexStatus(settings, "1234"); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(fl, "ocr_text") {
+		t.Errorf("expected ocr_text not to be requested with full indexing, got fl=%s", fl)
+	}
+}
+
+func TestDocumentPageId(t *testing.T) {
+	if id := documentPageId("1234!1234-page1", "1234"); id != "page1" {
+		t.Errorf("expected route prefix to be removed, got %s", id)
+	}
+}
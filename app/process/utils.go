@@ -30,7 +30,7 @@ func hasClassValue(elem xml.StartElement, str string) bool {
 // This utility function has no effect when Configuration requires subsequent conversion to
 // MiniOcr format.
 func fixResponse(input *string, settings model.Configuration) *string {
-	if settings.IndexType == "full" && settings.ConvertToMiniOcr == false {
+	if settings.IndexType == FullIndex && settings.ConvertToMiniOcr == false {
 		tmp := strings.ReplaceAll(*input, "\n", "")
 		tmp = strings.ReplaceAll(tmp, "\"", "'")
 		return &tmp
@@ -0,0 +1,5 @@
+package process
+
+// Version is the version of the processor, recorded with indexed pages. Release builds set it with
+// -ldflags "-X github.com/mspalti/ocrprocessor/process.Version=<version>".
+var Version = "dev"
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"github.com/fsnotify/fsnotify"
+	"github.com/mspalti/ocrprocessor/logging"
+	. "github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/scheduler"
+	"github.com/spf13/viper"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// service serves requests with the handler built from the current configuration and runs the DSpace poll
+// schedulers of the configuration and its tenants. The configuration is reloaded when the process receives
+// SIGHUP or the configuration file changes. A new configuration replaces the current one only if it is
+// valid, and requests in progress finish with the configuration they started with.
+type service struct {
+	mutex   sync.Mutex
+	config  *Configuration
+	tenants []*Configuration
+	handler atomic.Value
+	// ctx is the context of the poll schedulers, or nil if polling is stopped.
+	ctx     context.Context
+	pollers []*scheduler.Scheduler
+	// restarting counts the reloads that wait for the previous poll schedulers to stop, without holding the
+	// mutex, before starting new ones.
+	restarting sync.WaitGroup
+	// solr holds a configuration for each Solr core used since startup, so that pending updates are
+	// committed at shutdown.
+	solr map[string]*Configuration
+}
+
+// newService creates the service for the configuration and its tenants.
+func newService(config *Configuration, tenants []*Configuration) (*service, error) {
+	handler, err := newHandler(config, tenants)
+	if err != nil {
+		return nil, err
+	}
+	s := &service{solr: make(map[string]*Configuration)}
+	s.handler.Store(handler)
+	s.use(config, tenants)
+	return s, nil
+}
+
+func (s *service) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	s.handler.Load().(http.Handler).ServeHTTP(response, request)
+}
+
+// current returns the current configuration and the configurations of its tenants.
+func (s *service) current() (*Configuration, []*Configuration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.config, s.tenants
+}
+
+// use makes the configuration current.
+func (s *service) use(config *Configuration, tenants []*Configuration) {
+	s.config = config
+	s.tenants = tenants
+	for _, settings := range append([]*Configuration{config}, tenants...) {
+		key := strings.Join(settings.SolrUrls, "|") + "|" + settings.SolrUrl + "|" + settings.SolrCore
+		s.solr[key] = settings
+	}
+}
+
+// solrConfigs returns a configuration for each Solr core used since startup.
+func (s *service) solrConfigs() []*Configuration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var configs []*Configuration
+	for _, settings := range s.solr {
+		configs = append(configs, settings)
+	}
+	return configs
+}
+
+// startPolling starts a poll scheduler for the configuration and each tenant that has a poll interval.
+// Indexing by the schedulers uses the context.
+func (s *service) startPolling(ctx context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ctx = ctx
+	s.startPollers()
+}
+
+// startPollers starts the poll schedulers for the current configuration. The mutex must be held.
+func (s *service) startPollers() {
+	s.pollers = nil
+	for _, settings := range append([]*Configuration{s.config}, s.tenants...) {
+		if settings.PollInterval > 0 {
+			pollLogger := logger
+			if len(settings.Tenant) > 0 {
+				pollLogger = logger.With(logging.F("tenant", settings.Tenant))
+			}
+			poller := scheduler.New(settings, pollLogger)
+			poller.Start(s.ctx)
+			s.pollers = append(s.pollers, poller)
+			pollLogger.Info("DSpace polling started.", logging.F("interval", settings.PollInterval.String()))
+		}
+	}
+}
+
+// stopPolling stops the poll schedulers and waits for the Items in progress, including those of schedulers
+// that are being replaced by a reload.
+func (s *service) stopPolling() {
+	s.mutex.Lock()
+	s.ctx = nil
+	pollers := s.pollers
+	s.pollers = nil
+	s.mutex.Unlock()
+	stopPollers(pollers)
+	s.restarting.Wait()
+}
+
+func stopPollers(pollers []*scheduler.Scheduler) {
+	var stopped sync.WaitGroup
+	for _, poller := range pollers {
+		stopped.Add(1)
+		go func(poller *scheduler.Scheduler) {
+			defer stopped.Done()
+			poller.Stop()
+		}(poller)
+	}
+	stopped.Wait()
+}
+
+// watch reloads the configuration when the process receives SIGHUP or the configuration file changes.
+// Both triggers are handled by one goroutine, so that reloads never run concurrently and viper is only
+// used by reload. If the file cannot be watched, the configuration is reloaded on SIGHUP only.
+func (s *service) watch() {
+	// the file name is read before reloads can run
+	changed, err := watchFile(viper.ConfigFileUsed())
+	if err != nil {
+		logger.Warn("Unable to watch the configuration file, reload with SIGHUP.", logging.Err(err))
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-hangup:
+				s.reload("SIGHUP")
+			case <-changed:
+				s.reload("file changed")
+			}
+		}
+	}()
+}
+
+// watchFile returns a channel that receives a value when the file, or the file its symbolic link points to
+// in the same directory, is written or created, or when the link is changed. The directory of the file is watched, since editors and
+// Kubernetes ConfigMaps replace the file rather than write to it. Changes made while a reload is pending
+// are combined.
+func watchFile(file string) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	file = filepath.Clean(file)
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	changed := make(chan struct{}, 1)
+	go func() {
+		target, _ := filepath.EvalSymlinks(file)
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				current, _ := filepath.EvalSymlinks(file)
+				name := filepath.Clean(event.Name)
+				written := (name == file || name == target) && event.Op&(fsnotify.Write|fsnotify.Create) != 0
+				if !written && (len(current) == 0 || current == target) {
+					continue
+				}
+				target = current
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				logger.Warn("Error watching the configuration file.", logging.Err(err))
+			}
+		}
+	}()
+	return changed, nil
+}
+
+// reload reads and validates the configuration and, if it is valid and has changed, replaces the handler
+// and restarts the poll schedulers. Schedulers finish the Item in progress with the previous configuration.
+// Since that can take a while, they are stopped without holding the mutex, so that requests and shutdown
+// are not blocked. Settings that are only used at startup are logged if they changed.
+func (s *service) reload(reason string) {
+	pollers, restart, ok := s.replace(reason)
+	if !ok {
+		return
+	}
+	if restart {
+		stopPollers(pollers)
+		s.mutex.Lock()
+		// polling may have been stopped for shutdown in the meantime
+		if s.ctx != nil {
+			s.startPollers()
+		}
+		s.mutex.Unlock()
+		s.restarting.Done()
+	}
+	logger.Info("Configuration reloaded.", logging.F("reason", reason))
+}
+
+// replace makes a new valid configuration current and returns false if the configuration is unchanged or
+// invalid. If polling is running, the poll schedulers of the previous configuration are returned to be
+// stopped and restarted.
+func (s *service) replace(reason string) ([]*scheduler.Scheduler, bool, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	config, err := config()
+	if err == nil && reflect.DeepEqual(config, s.config) {
+		logger.Debug("Configuration unchanged.", logging.F("reason", reason))
+		return nil, false, false
+	}
+	var tenants []*Configuration
+	if err == nil {
+		tenants, err = validateConfig(config)
+	}
+	var level logging.Level
+	if err == nil {
+		level, err = logging.ParseLevel(config.LogLevel)
+	}
+	var handler http.Handler
+	if err == nil {
+		handler, err = newHandler(config, tenants)
+	}
+	if err != nil {
+		logger.Error("Configuration not reloaded.", logging.Err(err), logging.F("reason", reason))
+		return nil, false, false
+	}
+	previous := startupSettings(s.config)
+	for key, value := range startupSettings(config) {
+		if !reflect.DeepEqual(value, previous[key]) {
+			logger.Warn("Configuration change requires a restart.", logging.F("setting", key))
+		}
+	}
+	logger.SetLevel(level)
+	s.handler.Store(handler)
+	s.use(config, tenants)
+	if s.ctx == nil {
+		return nil, false, true
+	}
+	pollers := s.pollers
+	s.pollers = nil
+	s.restarting.Add(1)
+	return pollers, true, true
+}
+
+// startupSettings returns the settings that are only used when the service starts.
+func startupSettings(config *Configuration) map[string]interface{} {
+	return map[string]interface{}{
+		"http_port":           config.HttpPort,
+		"http_bind_address":   config.HttpBindAddress,
+		"tls_cert_file":       config.TlsCertFile,
+		"tls_key_file":        config.TlsKeyFile,
+		"tls_client_ca_file":  config.TlsClientCaFile,
+		"tls_client_auth":     config.TlsClientAuth,
+		"http_read_timeout":   config.HttpReadTimeout,
+		"http_write_timeout":  config.HttpWriteTimeout,
+		"http_idle_timeout":   config.HttpIdleTimeout,
+		"log_output":          config.LogOutput,
+		"log_dir":             config.LogDir,
+		"log_max_size":        config.LogMaxSize,
+		"log_rotate_interval": config.LogRotateInterval,
+		"log_max_backups":     config.LogMaxBackups,
+		"log_compress":        config.LogCompress,
+	}
+}
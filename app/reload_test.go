@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+	logger = logging.Discard()
+	dir := t.TempDir()
+	for _, name := range []string{"first.yml", "second.yml", "other.yml"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("http_port: 3000\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "config.yml")
+	if err := os.Symlink(filepath.Join(dir, "first.yml"), file); err != nil {
+		t.Fatal(err)
+	}
+	changed, err := watchFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(description string, signaled bool) {
+		t.Helper()
+		select {
+		case <-changed:
+			if !signaled {
+				t.Errorf("unexpected change signaled after %s", description)
+			}
+			// wait for the remaining events of the change
+			time.Sleep(100 * time.Millisecond)
+			select {
+			case <-changed:
+			default:
+			}
+		case <-time.After(500 * time.Millisecond):
+			if signaled {
+				t.Errorf("expected a change to be signaled after %s", description)
+			}
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.yml"), []byte("http_port: 3001\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("writing another file", false)
+	// replace the link like a Kubernetes ConfigMap update
+	link := filepath.Join(dir, "config.yml.new")
+	if err := os.Symlink(filepath.Join(dir, "second.yml"), link); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(link, file); err != nil {
+		t.Fatal(err)
+	}
+	expect("replacing the link", true)
+	// the file is written through the link
+	if err := ioutil.WriteFile(file, []byte("http_port: 3002\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	expect("writing the file", true)
+	expect("no change", false)
+}
+
+func TestReloadReleasesLockWhilePollersStop(t *testing.T) {
+	logger = logging.Discard()
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	// DSpace blocks the first poll like an Item that takes long to index
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	var releaseOnce sync.Once
+	releaseDSpace := func() {
+		releaseOnce.Do(func() { close(release) })
+	}
+	defer releaseDSpace()
+
+	config := validConfig(t)
+	config.DSpaceHost, config.ManifestBase = server.URL, server.URL
+	config.PollInterval = time.Hour
+	config.PollStateFile = filepath.Join(t.TempDir(), "poll_state.json")
+	svc, err := newService(config, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	svc.startPolling(ctx)
+	<-started
+
+	// the configuration file is read from the working directory
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	defer viper.Reset()
+	file := filepath.Join(dir, "config.yml")
+	yaml := fmt.Sprintf("http_port: \"3000\"\nlog_output: stdout\ndspace_host: %s\nmanifest_base: %s\n"+
+		"solr_url: http://localhost:8983/solr\nsolr_core: other\nindex_type: full\n", server.URL, server.URL)
+	if err := ioutil.WriteFile(file, []byte(yaml), 0644); err != nil {
+		t.Fatal(err)
+	}
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		svc.reload("test")
+	}()
+	// the configuration is replaced while the previous scheduler finishes its Item
+	replaced := make(chan struct{})
+	go func() {
+		defer close(replaced)
+		for {
+			if current, _ := svc.current(); current.SolrCore == "other" {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-replaced:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the configuration to be replaced while the scheduler is stopping")
+	}
+	select {
+	case <-reloaded:
+		t.Fatal("expected the reload to wait for the scheduler to stop")
+	default:
+	}
+	releaseDSpace()
+	<-reloaded
+	svc.stopPolling()
+	if len(svc.pollers) != 0 {
+		t.Errorf("expected no schedulers for a configuration without poll interval")
+	}
+}
@@ -0,0 +1,256 @@
+// Package scheduler periodically polls DSpace for modified Items and keeps their OCR index up to date.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	. "github.com/mspalti/ocrprocessor/err"
+	"github.com/mspalti/ocrprocessor/handler"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/metrics"
+	"github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// State is the persisted state of the scheduler.
+type State struct {
+	// Watermark is the lastModified time of the most recent Item processed, in the Solr date format.
+	Watermark string `json:"watermark"`
+	// Processed are the uuids of the Items processed that were modified at the watermark. The search
+	// includes the watermark, so these Items are found again and skipped by the next poll.
+	Processed []string `json:"processed,omitempty"`
+}
+
+// Scheduler polls DSpace at the configured interval. Items modified since the last poll are indexed
+// if IIIF search is enabled, and removed from the index if they were withdrawn or IIIF search was
+// disabled.
+type Scheduler struct {
+	config *model.Configuration
+	logger *logging.Logger
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New creates a scheduler for the configuration.
+func New(config *model.Configuration, logger *logging.Logger) *Scheduler {
+	return &Scheduler{config: config, logger: logger.With(logging.F("component", "scheduler")),
+		stop: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Start polls DSpace now and then at the poll interval until Stop is called. Indexing requests
+// use the context, so that canceling it interrupts the Item in progress.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.Poll(ctx); err != nil && !errors.Is(err, errStopped) {
+				s.logger.Error("DSpace poll failed.", logging.Err(err))
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops polling and waits for the Item in progress to finish.
+func (s *Scheduler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
+
+var errStopped = errors.New("scheduler stopped")
+
+// Poll processes the Items modified since the watermark in each configured collection, or in the
+// whole repository if no collections are configured, and saves the new watermark. Items modified at the
+// watermark that were processed by an earlier poll are skipped. With a single scope the watermark is also
+// saved when the poll stops early, so that the next poll resumes where it stopped.
+func (s *Scheduler) Poll(ctx context.Context) error {
+	state, err := LoadState(s.config.PollStateFile)
+	if err != nil {
+		return err
+	}
+	scopes := s.config.Collections
+	if len(scopes) == 0 {
+		scopes = []string{""}
+	}
+	start := time.Now()
+	skip := make(map[string]bool, len(state.Processed))
+	for _, uuid := range state.Processed {
+		skip[uuid] = true
+	}
+	watermark := state.Watermark
+	// atWatermark are the uuids of the Items processed that were modified at the watermark
+	atWatermark := make(map[string]bool, len(skip))
+	for uuid := range skip {
+		atWatermark[uuid] = true
+	}
+	processed := 0
+	for _, scope := range scopes {
+		var latest string
+		var uuids []string
+		var count int
+		latest, uuids, count, err = s.pollScope(ctx, scope, state.Watermark, skip)
+		processed += count
+		if latest > watermark {
+			watermark = latest
+			atWatermark = make(map[string]bool, len(uuids))
+		}
+		if latest == watermark {
+			for _, uuid := range uuids {
+				atWatermark[uuid] = true
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	changed := watermark != state.Watermark || len(atWatermark) != len(state.Processed)
+	if changed && (err == nil || len(scopes) == 1) {
+		next := State{Watermark: watermark}
+		for uuid := range atWatermark {
+			next.Processed = append(next.Processed, uuid)
+		}
+		sort.Strings(next.Processed)
+		if saveErr := SaveState(s.config.PollStateFile, next); saveErr != nil {
+			return saveErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Info("DSpace poll completed.", logging.F("items", processed), logging.F("watermark", watermark),
+		logging.Duration(start))
+	return nil
+}
+
+// pollScope processes the modified Items in the scope and returns the modification time of the most
+// recent Item processed and the uuids of the Items processed that were modified at that time. Items
+// modified at the since time that are in skip were processed by an earlier poll and are skipped. Items are
+// sorted by lastModified, so processing stops at the first Item that fails with a transient error and the
+// Item is retried on the next poll. Items that cannot be indexed, e.g. because they have no OCR files, are
+// skipped.
+func (s *Scheduler) pollScope(ctx context.Context, scope string, since string,
+	skip map[string]bool) (string, []string, int, error) {
+	latest := ""
+	var uuids []string
+	processed := 0
+	for page := 0; ; page++ {
+		response, err := process.SearchModifiedItems(*s.config, scope, since, page, s.logger)
+		if err != nil {
+			return latest, uuids, processed, err
+		}
+		for _, item := range response.Items() {
+			select {
+			case <-s.stop:
+				return latest, uuids, processed, errStopped
+			default:
+			}
+			modified, err := SolrTime(item.LastModified)
+			if err != nil {
+				return latest, uuids, processed, err
+			}
+			if modified == since && skip[item.Id] {
+				continue
+			}
+			if err := s.processItem(ctx, item); err != nil {
+				if _, permanent := err.(UnProcessableEntity); !permanent {
+					return latest, uuids, processed, err
+				}
+			}
+			processed++
+			if modified > latest {
+				latest = modified
+				uuids = nil
+			}
+			if modified == latest {
+				uuids = append(uuids, item.Id)
+			}
+		}
+		if page+1 >= response.Embedded.SearchResult.Page.TotalPages {
+			return latest, uuids, processed, nil
+		}
+	}
+}
+
+// processItem indexes or removes the Item.
+func (s *Scheduler) processItem(ctx context.Context, item model.DSpaceItem) error {
+	log := s.logger.With(logging.F(logging.ItemKey, item.Id))
+	uuid := item.Id
+	action := handler.IndexAction
+	var indexer handler.Indexer = handler.AddItem{}
+	if !item.SearchEnabled() {
+		indexed, err := process.CheckSolr(*s.config, uuid)
+		if err != nil || !indexed {
+			return err
+		}
+		action = handler.DeleteAction
+		indexer = handler.DeleteItem{}
+	}
+	_, err := handler.HandleAction(ctx, indexer, s.config, &uuid, log)
+	result := "success"
+	if err != nil {
+		result = "failure"
+		log.Warn("Scheduled "+action+" failed.", logging.Err(err))
+	}
+	metrics.Items.Inc(action, result)
+	return err
+}
+
+// solrTimeFormat is the Solr date format used for the watermark. Times in this format sort chronologically.
+const solrTimeFormat = "2006-01-02T15:04:05.000Z"
+
+// SolrTime converts a DSpace lastModified time to the Solr date format in UTC.
+func SolrTime(lastModified string) (string, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05.000Z0700"} {
+		if t, err := time.Parse(layout, lastModified); err == nil {
+			return t.UTC().Format(solrTimeFormat), nil
+		}
+	}
+	return "", errors.New("invalid lastModified time: " + lastModified)
+}
+
+// LoadState reads the scheduler state from the file. A missing file is an empty state.
+func LoadState(path string) (State, error) {
+	var state State
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	return state, err
+}
+
+// SaveState writes the scheduler state to a temporary file that replaces the file, so that the state
+// is not lost if the process stops while writing.
+func SaveState(path string, state State) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func discoveryItem(uuid string, modified string, withdrawn bool, searchEnabled string) string {
+	return fmt.Sprintf(`{"_embedded":{"indexableObject":{"uuid":"%s","inArchive":true,"withdrawn":%t,
+"lastModified":"%s","metadata":{"dspace.iiif.enabled":[{"value":"true"}],
+"iiif.search.enabled":[{"value":"%s"}]}}}}`, uuid, withdrawn, modified, searchEnabled)
+}
+
+func TestPoll(t *testing.T) {
+	pages := [][]string{
+		{discoveryItem("a", "2026-01-01T10:00:00.000+00:00", false, "false")},
+		{discoveryItem("b", "2026-01-02T10:00:00.000+00:00", true, "true")},
+	}
+	var mutex sync.Mutex
+	var queries []string
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.URL.Path == "/api/discover/search/objects":
+			queries = append(queries, r.URL.Query().Get("query"))
+			page := 0
+			_, _ = fmt.Sscanf(r.URL.Query().Get("page"), "%d", &page)
+			_, _ = fmt.Fprintf(w, `{"_embedded":{"searchResult":{"_embedded":{"objects":[%s]},
+"page":{"number":%d,"totalPages":%d}}}}`, strings.Join(pages[page], ","), page, len(pages))
+		case strings.HasSuffix(r.URL.Path, "/select"):
+			// only item b is in the index
+			found := 0
+			if strings.Contains(r.URL.Query().Get("q"), "/b/") {
+				found = 1
+			}
+			_, _ = fmt.Fprintf(w, `{"response":{"numFound":%d,"docs":[]}}`, found)
+		case strings.HasSuffix(r.URL.Path, "/update"):
+			body, _ := ioutil.ReadAll(r.Body)
+			deleted = append(deleted, string(body))
+			_, _ = fmt.Fprint(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	stateFile := filepath.Join(t.TempDir(), "state", "poll.json")
+	config := &model.Configuration{DSpaceHost: server.URL, ManifestBase: server.URL, SolrUrl: server.URL,
+		SolrCore: "core", PollStateFile: stateFile}
+	s := New(config, logging.Discard())
+	if err := s.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || !strings.Contains(deleted[0], "%2Fb%2F") {
+		t.Errorf("expected only the withdrawn indexed item to be deleted, got %v", deleted)
+	}
+	state, err := LoadState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Watermark != "2026-01-02T10:00:00.000Z" || len(state.Processed) != 1 || state.Processed[0] != "b" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+
+	// the next poll starts at the saved watermark and skips the item processed at the watermark
+	queries = nil
+	pages = [][]string{{discoveryItem("b", "2026-01-02T10:00:00.000+00:00", true, "true")}}
+	if err := s.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(queries) == 0 || queries[0] != "lastModified:[2026-01-02T10:00:00.000Z TO *]" {
+		t.Errorf("unexpected discovery query: %v", queries)
+	}
+	if len(deleted) != 1 {
+		t.Errorf("expected the item at the watermark not to be processed again, got %v", deleted)
+	}
+
+	// items modified at the watermark later are processed and added to the state
+	pages = [][]string{{discoveryItem("b", "2026-01-02T10:00:00.000+00:00", true, "true"),
+		discoveryItem("c", "2026-01-02T10:00:00.000+00:00", false, "false")}}
+	if err := s.Poll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	state, err = LoadState(stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Watermark != "2026-01-02T10:00:00.000Z" || strings.Join(state.Processed, ",") != "b,c" {
+		t.Errorf("unexpected state: %+v", state)
+	}
+}
+
+func TestSolrTime(t *testing.T) {
+	for _, modified := range []string{"2026-03-04T05:06:07.089+00:00", "2026-03-04T06:06:07.089+0100",
+		"2026-03-04T05:06:07.089Z"} {
+		converted, err := SolrTime(modified)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if converted != "2026-03-04T05:06:07.089Z" {
+			t.Errorf("unexpected time for %s: %s", modified, converted)
+		}
+	}
+	if _, err := SolrTime("yesterday"); err == nil {
+		t.Error("expected an error for an invalid time")
+	}
+}
+
+func TestSearchEnabled(t *testing.T) {
+	enabled := model.DSpaceItem{InArchive: true, Metadata: map[string][]model.DSpaceMetadataValue{
+		"dspace.iiif.enabled": {{Value: "true"}}, "iiif.search.enabled": {{Value: "true"}}}}
+	if !enabled.SearchEnabled() {
+		t.Error("expected search to be enabled")
+	}
+	withdrawn := enabled
+	withdrawn.Withdrawn = true
+	if withdrawn.SearchEnabled() {
+		t.Error("expected search to be disabled for a withdrawn item")
+	}
+	if (model.DSpaceItem{InArchive: true}).SearchEnabled() {
+		t.Error("expected search to be disabled without metadata")
+	}
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Default permissions of files and directories in local storage.
+const (
+	DefaultFileMode os.FileMode = 0644
+	DefaultDirMode  os.FileMode = 0755
+)
+
+// LocalOptions configure local storage. Zero modes use the defaults, and empty owner and group
+// leave the ownership unchanged.
+type LocalOptions struct {
+	Root     string
+	FileMode os.FileMode
+	DirMode  os.FileMode
+	Owner    string
+	Group    string
+}
+
+// Local stores files in a directory of the local file system.
+type Local struct {
+	options LocalOptions
+}
+
+// NewLocal creates local storage in the root directory.
+func NewLocal(options LocalOptions) *Local {
+	if options.FileMode == 0 {
+		options.FileMode = DefaultFileMode
+	}
+	if options.DirMode == 0 {
+		options.DirMode = DefaultDirMode
+	}
+	options.Root = filepath.Clean(options.Root)
+	return &Local{options: options}
+}
+
+// Write writes the file atomically: the content is written to a temporary file in the same directory,
+// flushed to disk, and renamed, so that Solr never reads a partly written file. The directories of the
+// key are created, and created again if they were removed as empty by a concurrent Remove.
+func (l *Local) Write(key string, content []byte) error {
+	path := l.path(key)
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = os.MkdirAll(filepath.Dir(path), l.options.DirMode); err != nil {
+			return err
+		}
+		if err = l.writeAtomic(path, content); !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (l *Local) writeAtomic(path string, content []byte) error {
+	dir, name := filepath.Split(path)
+	temp, err := ioutil.TempFile(dir, "."+name+".tmp-")
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = temp.Close()
+			_ = os.Remove(temp.Name())
+		}
+	}()
+	if _, err := temp.Write(content); err != nil {
+		return err
+	}
+	// the temporary file is created with mode 0600
+	if err := temp.Chmod(l.options.FileMode); err != nil {
+		return err
+	}
+	if err := chown(temp, l.options.Owner, l.options.Group); err != nil {
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return err
+	}
+	committed = true
+	return syncDir(dir)
+}
+
+// Remove removes the file and the directories that are left empty.
+func (l *Local) Remove(key string) error {
+	path := l.path(key)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	l.removeEmptyDirs(filepath.Dir(path))
+	return nil
+}
+
+// Exists returns true if the file exists.
+func (l *Local) Exists(key string) (bool, error) {
+	_, err := os.Stat(l.path(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// List walks the directory of the prefix. Hidden files, such as temporary files, are not listed.
+func (l *Local) List(prefix string, visit func(object Object) error) error {
+	dir := l.options.Root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = l.path(prefix[:i])
+	}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			return nil
+		}
+		key, err := filepath.Rel(l.options.Root, path)
+		if err != nil {
+			return err
+		}
+		key = filepath.ToSlash(key)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return visit(Object{Key: key, Modified: info.ModTime()})
+	})
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+// Rename moves the file and removes the directories that are left empty.
+func (l *Local) Rename(from string, to string) error {
+	target := l.path(to)
+	if err := os.MkdirAll(filepath.Dir(target), l.options.DirMode); err != nil {
+		return err
+	}
+	if err := os.Rename(l.path(from), target); err != nil {
+		return err
+	}
+	l.removeEmptyDirs(filepath.Dir(l.path(from)))
+	return nil
+}
+
+// Check verifies that the root is a directory in which files can be created.
+func (l *Local) Check() error {
+	info, err := os.Stat(l.options.Root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return errors.New("not a directory: " + l.options.Root)
+	}
+	file, err := ioutil.TempFile(l.options.Root, ".health-")
+	if err != nil {
+		return errors.New("directory is not writable: " + err.Error())
+	}
+	name := file.Name()
+	_ = file.Close()
+	return os.Remove(name)
+}
+
+func (l *Local) path(key string) string {
+	return filepath.Join(l.options.Root, filepath.FromSlash(key))
+}
+
+// removeEmptyDirs removes the directory and its parents below the root while they are empty.
+func (l *Local) removeEmptyDirs(dir string) {
+	root := l.options.Root
+	for dir = filepath.Clean(dir); strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
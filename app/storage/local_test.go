@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	dir := t.TempDir()
+	options := LocalOptions{Root: dir, FileMode: 0640}
+	if runtime.GOOS != "windows" {
+		options.Owner = fmt.Sprint(os.Getuid())
+		options.Group = fmt.Sprint(os.Getgid())
+	}
+	store := NewLocal(options)
+	for _, content := range []string{"<ocr>first</ocr>", "<ocr>second</ocr>"} {
+		if err := store.Write("41/1234/page1.xml", []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path := filepath.Join(dir, "41", "1234", "page1.xml")
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "<ocr>second</ocr>" {
+		t.Errorf("unexpected content: %s", data)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected temporary files to be removed, found %d files", len(entries))
+	}
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0640 {
+			t.Errorf("unexpected file mode: %v", info.Mode().Perm())
+		}
+	}
+
+	if err := store.Rename("41/1234/page1.xml", "41/1234-page1.xml"); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	if err := store.List("41/1234", func(object Object) error {
+		keys = append(keys, object.Key)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "41/1234-page1.xml" {
+		t.Errorf("unexpected keys: %v", keys)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "41", "1234")); !os.IsNotExist(err) {
+		t.Error("expected the empty directory to be removed after the rename")
+	}
+	if err := store.Remove("41/1234-page1.xml"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Remove("41/1234-page1.xml"); err != nil {
+		t.Errorf("expected a missing file to be ignored: %v", err)
+	}
+	if exists, err := store.Exists("41/1234-page1.xml"); err != nil || exists {
+		t.Errorf("expected the file to be removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "41")); !os.IsNotExist(err) {
+		t.Error("expected the empty directory to be removed")
+	}
+	if err := store.Check(); err != nil {
+		t.Errorf("expected the check to pass: %v", err)
+	}
+}
+
+func TestLookupOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file ownership is not supported on Windows")
+	}
+	uid, gid, err := LookupOwner("", "")
+	if err != nil || uid != -1 || gid != -1 {
+		t.Errorf("expected unchanged ownership, got %d %d %v", uid, gid, err)
+	}
+	uid, gid, err = LookupOwner("1234", "5678")
+	if err != nil || uid != 1234 || gid != 5678 {
+		t.Errorf("expected numeric ids, got %d %d %v", uid, gid, err)
+	}
+	if _, _, err := LookupOwner("no-such-user-for-ocr-tests", ""); err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
@@ -0,0 +1,62 @@
+//go:build !windows
+// +build !windows
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+// LookupOwner returns the user and group ids for the lazy_file_owner and lazy_file_group settings,
+// which can be names or numeric ids. The id is -1 if the setting is empty.
+func LookupOwner(owner string, group string) (int, int, error) {
+	uid, gid := -1, -1
+	if len(owner) > 0 {
+		id, err := strconv.Atoi(owner)
+		if err != nil {
+			u, lookupErr := user.Lookup(owner)
+			if lookupErr != nil {
+				return uid, gid, fmt.Errorf("unknown lazy_file_owner %q: %v", owner, lookupErr)
+			}
+			id, _ = strconv.Atoi(u.Uid)
+		}
+		uid = id
+	}
+	if len(group) > 0 {
+		id, err := strconv.Atoi(group)
+		if err != nil {
+			g, lookupErr := user.LookupGroup(group)
+			if lookupErr != nil {
+				return uid, gid, fmt.Errorf("unknown lazy_file_group %q: %v", group, lookupErr)
+			}
+			id, _ = strconv.Atoi(g.Gid)
+		}
+		gid = id
+	}
+	return uid, gid, nil
+}
+
+// chown sets the owner and group of the file if configured.
+func chown(file *os.File, owner string, group string) error {
+	if len(owner) == 0 && len(group) == 0 {
+		return nil
+	}
+	uid, gid, err := LookupOwner(owner, group)
+	if err != nil {
+		return err
+	}
+	return file.Chown(uid, gid)
+}
+
+// syncDir flushes the directory entry of a renamed file to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,28 @@
+//go:build windows
+// +build windows
+
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// LookupOwner returns an error if lazy_file_owner or lazy_file_group is set, since file ownership
+// is not supported on Windows.
+func LookupOwner(owner string, group string) (int, int, error) {
+	if len(owner) > 0 || len(group) > 0 {
+		return -1, -1, errors.New("lazy_file_owner and lazy_file_group are not supported on Windows")
+	}
+	return -1, -1, nil
+}
+
+func chown(file *os.File, owner string, group string) error {
+	_, _, err := LookupOwner(owner, group)
+	return err
+}
+
+// syncDir does nothing, since directories cannot be flushed on Windows.
+func syncDir(dir string) error {
+	return nil
+}
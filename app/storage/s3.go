@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configure S3 compatible object storage.
+type S3Options struct {
+	// Endpoint is the base url of the service, e.g. https://s3.us-east-1.amazonaws.com or http://minio:9000.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is added to all keys, e.g. "ocr/".
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	// PathStyle addresses the bucket in the url path rather than the host name, as required by most
+	// S3 compatible services.
+	PathStyle bool
+}
+
+// S3 stores files as objects in an S3 bucket. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	options S3Options
+	base    *url.URL
+	client  *http.Client
+}
+
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// NewS3 creates S3 storage.
+func NewS3(options S3Options) (*S3, error) {
+	if len(options.Endpoint) == 0 || len(options.Bucket) == 0 {
+		return nil, errors.New("s3_endpoint and s3_bucket are required for s3 storage")
+	}
+	base, err := url.Parse(strings.TrimSuffix(options.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3_endpoint: %v", err)
+	}
+	if options.PathStyle {
+		base.Path += "/" + options.Bucket
+	} else {
+		base.Host = options.Bucket + "." + base.Host
+	}
+	if len(options.Region) == 0 {
+		options.Region = "us-east-1"
+	}
+	return &S3{options: options, base: base, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+// Write uploads the object. S3 objects are replaced atomically.
+func (s *S3) Write(key string, content []byte) error {
+	resp, err := s.request("PUT", s.options.Prefix+key, nil, nil, content)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Remove deletes the object.
+func (s *S3) Remove(key string) error {
+	resp, err := s.request("DELETE", s.options.Prefix+key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Exists returns true if the object exists.
+func (s *S3) Exists(key string) (bool, error) {
+	resp, err := s.request("HEAD", s.options.Prefix+key, nil, nil, nil)
+	if err != nil {
+		if resp != nil && resp.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+	resp.Body.Close()
+	return true, nil
+}
+
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List lists the objects with ListObjectsV2.
+func (s *S3) List(prefix string, visit func(object Object) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.options.Prefix + prefix}}
+		if len(token) > 0 {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.request("GET", "", query, nil, nil)
+		if err != nil {
+			return err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+		for _, content := range result.Contents {
+			object := Object{Key: strings.TrimPrefix(content.Key, s.options.Prefix), Modified: content.LastModified}
+			if err := visit(object); err != nil {
+				return err
+			}
+		}
+		if !result.IsTruncated || len(result.NextContinuationToken) == 0 {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// Rename copies the object to the new key and deletes the original.
+func (s *S3) Rename(from string, to string) error {
+	source := "/" + s.options.Bucket + "/" + encodePath(s.options.Prefix+from)
+	resp, err := s.request("PUT", s.options.Prefix+to, nil, map[string]string{"x-amz-copy-source": source}, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return s.Remove(from)
+}
+
+// Check writes and removes an object.
+func (s *S3) Check() error {
+	key := ".health-" + fmt.Sprint(time.Now().UnixNano())
+	if err := s.Write(key, nil); err != nil {
+		return errors.New("bucket is not writable: " + err.Error())
+	}
+	return s.Remove(key)
+}
+
+// request sends a signed request for the object key, or for the bucket if the key is empty. Responses
+// with status codes other than 2xx are returned with an error.
+func (s *S3) request(method string, key string, query url.Values, headers map[string]string,
+	body []byte) (*http.Response, error) {
+	target := *s.base
+	target.Path += "/" + key
+	target.RawPath = s.base.EscapedPath() + "/" + encodePath(key)
+	target.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequest(method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	s.sign(req, body, time.Now().UTC())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		resp.Body.Close()
+		return resp, fmt.Errorf("s3 %s %s failed: %s %s", method, key, resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// sign adds the AWS Signature Version 4 authorization header to the request.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	names := []string{"host"}
+	values := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+			values[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + values[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{req.Method, req.URL.EscapedPath(), req.URL.RawQuery,
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + s.options.Region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSha256([]byte("AWS4"+s.options.SecretKey), date)
+	key = hmacSha256(key, s.options.Region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.options.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// encodeValue encodes all characters except the unreserved characters, as required for signing.
+func encodeValue(value string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' || b == '-' || b == '_' ||
+			b == '.' || b == '~' {
+			encoded.WriteByte(b)
+		} else {
+			encoded.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return encoded.String()
+}
+
+// encodePath encodes the segments of an object key.
+func encodePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = encodeValue(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery encodes the query parameters sorted by name.
+func canonicalQuery(query url.Values) string {
+	var names []string
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			params = append(params, encodeValue(name)+"="+encodeValue(value))
+		}
+	}
+	return strings.Join(params, "&")
+}
@@ -0,0 +1,52 @@
+// Package storage stores the OCR files used for lazy indexing on the local file system or in S3
+// compatible object storage. Files are identified by keys relative to the storage root, with "/"
+// separators.
+package storage
+
+import (
+	"fmt"
+	"github.com/mspalti/ocrprocessor/model"
+	"time"
+)
+
+// Storage backends.
+const (
+	LocalStorage = "local"
+	S3Storage    = "s3"
+)
+
+// Object is a stored file.
+type Object struct {
+	Key      string
+	Modified time.Time
+}
+
+// Storage stores OCR files.
+type Storage interface {
+	// Write stores the content under the key. Readers see either the previous or the new content.
+	Write(key string, content []byte) error
+	// Remove removes the file. Files that do not exist are ignored.
+	Remove(key string) error
+	// Exists returns true if the file exists.
+	Exists(key string) (bool, error)
+	// List calls visit for each file with a key that starts with the prefix.
+	List(prefix string, visit func(object Object) error) error
+	// Rename moves the file to a new key.
+	Rename(from string, to string) error
+	// Check verifies that files can be written.
+	Check() error
+}
+
+// New returns the storage backend for the configuration.
+func New(config model.Configuration) (Storage, error) {
+	switch config.LazyStorage {
+	case "", LocalStorage:
+		return NewLocal(LocalOptions{Root: config.XmlFileLocation, FileMode: config.LazyFileMode,
+			DirMode: config.LazyDirMode, Owner: config.LazyFileOwner, Group: config.LazyFileGroup}), nil
+	case S3Storage:
+		return NewS3(S3Options{Endpoint: config.S3Endpoint, Region: config.S3Region, Bucket: config.S3Bucket,
+			Prefix: config.S3Prefix, AccessKey: config.S3AccessKey, SecretKey: config.S3SecretKey,
+			PathStyle: config.S3PathStyle})
+	}
+	return nil, fmt.Errorf("unknown lazy_storage %q: expected local or s3", config.LazyStorage)
+}
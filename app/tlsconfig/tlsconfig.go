@@ -0,0 +1,137 @@
+// Package tlsconfig creates the TLS configuration of the http server.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reloadInterval is the minimum time between checks for renewed certificate files.
+const reloadInterval = 10 * time.Second
+
+// Client authentication modes.
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// ServerConfig returns the TLS configuration for the server certificate and client CA in the
+// configuration, or nil if no certificate is configured. The certificate is reloaded when the
+// certificate or key file changes, so renewed certificates are used without a restart.
+func ServerConfig(config model.Configuration, logger *logging.Logger) (*tls.Config, error) {
+	if len(config.TlsCertFile) == 0 && len(config.TlsKeyFile) == 0 {
+		if len(config.TlsClientCaFile) > 0 {
+			return nil, errors.New("tls_client_ca_file requires tls_cert_file and tls_key_file")
+		}
+		return nil, nil
+	}
+	if len(config.TlsCertFile) == 0 || len(config.TlsKeyFile) == 0 {
+		return nil, errors.New("both tls_cert_file and tls_key_file are required")
+	}
+	cert := &certificate{certFile: config.TlsCertFile, keyFile: config.TlsKeyFile, logger: logger}
+	if err := cert.load(); err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+	}
+	clientAuth, err := ClientAuth(config)
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth != ClientAuthNone {
+		pem, err := ioutil.ReadFile(config.TlsClientCaFile)
+		if err != nil {
+			return nil, errors.New("could not read client CA file: " + err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in client CA file: " + config.TlsClientCaFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if clientAuth == ClientAuthRequire {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return tlsConfig, nil
+}
+
+// ClientAuth returns the client certificate mode: none, optional, or require. The mode defaults to
+// require when a client CA is configured.
+func ClientAuth(config model.Configuration) (string, error) {
+	mode := strings.ToLower(config.TlsClientAuth)
+	if len(config.TlsClientCaFile) == 0 {
+		if mode == ClientAuthOptional || mode == ClientAuthRequire {
+			return "", errors.New("tls_client_auth " + mode + " requires tls_client_ca_file")
+		}
+		return ClientAuthNone, nil
+	}
+	switch mode {
+	case "":
+		return ClientAuthRequire, nil
+	case ClientAuthNone, ClientAuthOptional, ClientAuthRequire:
+		return mode, nil
+	}
+	return "", errors.New("unknown tls_client_auth mode: " + config.TlsClientAuth)
+}
+
+// certificate holds the server certificate and reloads it when its files change.
+type certificate struct {
+	mutex    sync.Mutex
+	certFile string
+	keyFile  string
+	logger   *logging.Logger
+	cert     *tls.Certificate
+	modified time.Time
+	checked  time.Time
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if time.Since(c.checked) >= reloadInterval {
+		c.checked = time.Now()
+		if c.lastModified().After(c.modified) {
+			if err := c.load(); err != nil {
+				c.logger.Warn("Unable to reload TLS certificate, using the previous certificate.", logging.Err(err))
+			} else {
+				c.logger.Info("Reloaded TLS certificate.", logging.F(logging.FileKey, c.certFile))
+			}
+		}
+	}
+	return c.cert, nil
+}
+
+func (c *certificate) load() error {
+	modified := c.lastModified()
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return errors.New("could not load TLS certificate: " + err.Error())
+	}
+	c.cert = &cert
+	c.modified = modified
+	c.checked = time.Now()
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and key files.
+func (c *certificate) lastModified() time.Time {
+	var modified time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	return modified
+}
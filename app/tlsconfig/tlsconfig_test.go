@@ -0,0 +1,105 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/mspalti/ocrprocessor/logging"
+	"github.com/mspalti/ocrprocessor/model"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate and key for the common name.
+func writeCertificate(t *testing.T, certFile string, keyFile string, name string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "first")
+	cert := &certificate{certFile: certFile, keyFile: keyFile, logger: logging.Discard()}
+	if err := cert.load(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeCertificate(t, certFile, keyFile, "renewed")
+	later := time.Now().Add(time.Minute)
+	_ = os.Chtimes(certFile, later, later)
+	current, _ := cert.get(nil)
+	if commonName(t, current) != "first" {
+		t.Errorf("expected certificate files to be checked at most once per interval")
+	}
+	cert.checked = time.Time{}
+	current, _ = cert.get(nil)
+	if commonName(t, current) != "renewed" {
+		t.Errorf("expected renewed certificate to be loaded")
+	}
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeCertificate(t, certFile, keyFile, "server")
+
+	if tlsConfig, err := ServerConfig(model.Configuration{}, logging.Discard()); tlsConfig != nil || err != nil {
+		t.Errorf("expected no TLS configuration without a certificate")
+	}
+	if _, err := ServerConfig(model.Configuration{TlsCertFile: certFile}, logging.Discard()); err == nil {
+		t.Errorf("expected error for missing key file")
+	}
+	config := model.Configuration{TlsCertFile: certFile, TlsKeyFile: keyFile, TlsClientCaFile: certFile}
+	tlsConfig, err := ServerConfig(config, logging.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Errorf("expected client certificates to be required when a client CA is configured")
+	}
+	config.TlsClientAuth = ClientAuthOptional
+	if tlsConfig, _ := ServerConfig(config, logging.Discard()); tlsConfig.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("expected optional client certificates")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"fmt"
+	"github.com/mspalti/ocrprocessor/auth"
+	"github.com/mspalti/ocrprocessor/logging"
+	. "github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"github.com/mspalti/ocrprocessor/storage"
+	"github.com/mspalti/ocrprocessor/tlsconfig"
+	"github.com/spf13/viper"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// durationKeys are the configuration keys of durations, e.g. "30s".
+var durationKeys = []string{"poll_interval", "http_read_timeout", "http_write_timeout", "http_idle_timeout",
+	"shutdown_timeout", "log_rotate_interval"}
+
+// integerKeys are the configuration keys of whole numbers.
+var integerKeys = []string{"input_image_resolution", "log_max_size", "log_max_backups"}
+
+// configErrors lists the problems found in the configuration.
+type configErrors []string
+
+func (e configErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+func (e *configErrors) add(format string, args ...interface{}) {
+	*e = append(*e, fmt.Sprintf(format, args...))
+}
+
+// check adds the error, or each of the problems if the error lists problems itself.
+func (e *configErrors) check(err error) {
+	if problems, ok := err.(configErrors); ok {
+		*e = append(*e, problems...)
+	} else if err != nil {
+		*e = append(*e, err.Error())
+	}
+}
+
+// validateConfig verifies the configuration and returns the configuration of each tenant. The error lists
+// all problems found as configErrors.
+func validateConfig(config *Configuration) ([]*Configuration, error) {
+	var problems configErrors
+	checkValues(&problems)
+	checkServer(config, &problems)
+	_, _, err := storage.LookupOwner(config.LazyFileOwner, config.LazyFileGroup)
+	problems.check(err)
+	if config.LazyFileCompression != process.NoCompression && config.LazyFileCompression != process.Minify {
+		problems.add("invalid lazy_file_compression %q: expected none or minify", config.LazyFileCompression)
+	}
+	problems.check(process.ValidateFileLayout(config.LazyFileLayout))
+	if config.InputImageResolution <= 0 {
+		problems.add("invalid input_image_resolution %d: expected a positive number", config.InputImageResolution)
+	}
+	tenants, err := tenantConfigs(config)
+	problems.check(err)
+	for _, settings := range append([]*Configuration{config}, tenants...) {
+		checkRepository(settings, &problems)
+	}
+	if len(problems) > 0 {
+		return nil, problems
+	}
+	return tenants, nil
+}
+
+// checkValues verifies the format of configuration values that are read without reporting errors.
+func checkValues(problems *configErrors) {
+	for _, key := range durationKeys {
+		if value, ok := viper.Get(key).(string); ok && len(value) > 0 {
+			if duration, err := time.ParseDuration(value); err != nil || duration < 0 {
+				problems.add("invalid %s %q: expected a duration such as 30s or 15m", key, value)
+			}
+		}
+	}
+	for _, key := range integerKeys {
+		if value := viper.Get(key); value != nil {
+			if _, err := strconv.Atoi(fmt.Sprint(value)); err != nil {
+				problems.add("invalid %s %q: expected a whole number", key, fmt.Sprint(value))
+			}
+		}
+	}
+	for _, key := range []string{"lazy_file_mode", "lazy_dir_mode"} {
+		if viper.Get(key) != nil {
+			_, err := configFileMode(key)
+			problems.check(err)
+		}
+	}
+}
+
+// checkServer verifies the settings of the http server, authentication, and logging.
+func checkServer(config *Configuration, problems *configErrors) {
+	if port, err := strconv.Atoi(config.HttpPort); err != nil || port < 1 || port > 65535 {
+		problems.add("invalid http_port %q: expected a port number from 1 to 65535", config.HttpPort)
+	}
+	_, err := tlsconfig.ServerConfig(*config, logging.Discard())
+	problems.check(err)
+	_, err = auth.New(*config, logging.Discard())
+	problems.check(err)
+	if _, err := logging.ParseLevel(config.LogLevel); err != nil {
+		problems.add("invalid log_level %q: expected debug, info, warn, or error", config.LogLevel)
+	}
+	switch strings.ToLower(config.LogOutput) {
+	case "stdout", "stderr":
+	case "file", "":
+		logDir := config.LogDir
+		if len(logDir) == 0 {
+			logDir = "."
+		}
+		problems.check(writableDir("log_dir", logDir))
+	default:
+		problems.add("invalid log_output %q: expected stdout, stderr, or file", config.LogOutput)
+	}
+}
+
+// checkRepository verifies the DSpace, Solr, and indexing settings of the configuration or a tenant.
+func checkRepository(config *Configuration, problems *configErrors) {
+	var repository configErrors
+	if len(config.DSpaceHost) == 0 {
+		repository.add("dspace_host is required")
+	}
+	repository.check(checkUrl("dspace_host", config.DSpaceHost))
+	repository.check(checkUrl("manifest_base", config.ManifestBase))
+	if len(config.SolrUrl) == 0 && len(config.SolrUrls) == 0 {
+		repository.add("solr_url or solr_urls is required")
+	}
+	repository.check(checkUrl("solr_url", config.SolrUrl))
+	for _, solrUrl := range config.SolrUrls {
+		repository.check(checkUrl("solr_urls", solrUrl))
+	}
+	if len(config.SolrCore) == 0 || strings.Contains(config.SolrCore, "/") {
+		repository.add("invalid solr_core %q: expected the name of the core or collection", config.SolrCore)
+	}
+	if len(config.SolrToken) > 0 && len(config.SolrUsername) > 0 {
+		repository.add("solr_token and solr_username cannot both be set")
+	}
+	switch config.IndexType {
+	case process.FullIndex:
+		if config.EscapeUtf8 {
+			repository.add("escape_utf8 requires lazy indexing")
+		}
+	case process.LazyIndex:
+		if len(config.XmlFileLocation) == 0 {
+			repository.add("xml_file_location is required for lazy indexing")
+		} else if config.LazyStorage == storage.LocalStorage {
+			repository.check(writableDir("xml_file_location", config.XmlFileLocation))
+		}
+	default:
+		repository.add("invalid index_type %q: expected full or lazy", config.IndexType)
+	}
+	_, err := storage.New(*config)
+	repository.check(err)
+	if config.PollInterval > 0 {
+		repository.check(writableDir("poll_state_file directory", filepath.Dir(config.PollStateFile)))
+	}
+	for _, problem := range repository {
+		if len(config.Tenant) > 0 {
+			problem = "tenant " + config.Tenant + ": " + problem
+		}
+		*problems = append(*problems, problem)
+	}
+}
+
+// checkUrl verifies that the value, if set, is an http or https URL without a trailing slash.
+func checkUrl(key string, value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+		return fmt.Errorf("invalid %s %q: expected an http or https URL", key, value)
+	}
+	if strings.HasSuffix(value, "/") {
+		return fmt.Errorf("invalid %s %q: remove the trailing slash", key, value)
+	}
+	return nil
+}
+
+// writableDir verifies that the directory exists and files can be created in it.
+func writableDir(key string, dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("%s %q does not exist", key, dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s %q is not a directory", key, dir)
+	}
+	file, err := ioutil.TempFile(dir, ".ocr_processor_check_")
+	if err != nil {
+		return fmt.Errorf("%s %q is not writable", key, dir)
+	}
+	_ = file.Close()
+	_ = os.Remove(file.Name())
+	return nil
+}
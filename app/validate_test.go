@@ -0,0 +1,151 @@
+package main
+
+import (
+	. "github.com/mspalti/ocrprocessor/model"
+	"github.com/mspalti/ocrprocessor/process"
+	"github.com/mspalti/ocrprocessor/storage"
+	"os"
+	"strings"
+	"testing"
+)
+
+func validConfig(t *testing.T) *Configuration {
+	return &Configuration{
+		HttpPort:             "3000",
+		LogOutput:            "stdout",
+		DSpaceHost:           "http://localhost:8080/server",
+		ManifestBase:         "http://localhost:8080/server",
+		SolrUrl:              "http://localhost:8983/solr",
+		SolrCore:             "word_highlighting",
+		IndexType:            process.LazyIndex,
+		EscapeUtf8:           true,
+		XmlFileLocation:      t.TempDir(),
+		LazyFileLayout:       process.DefaultFileLayout,
+		LazyFileCompression:  process.NoCompression,
+		LazyStorage:          storage.LocalStorage,
+		InputImageResolution: 300,
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	if _, err := validateConfig(validConfig(t)); err != nil {
+		t.Fatalf("expected valid configuration, got %v", err)
+	}
+
+	config := validConfig(t)
+	config.HttpPort = "0"
+	config.DSpaceHost = "http://localhost:8080/server/"
+	config.SolrUrl = "localhost:8983"
+	config.IndexType = "ful"
+	config.LogLevel = "verbose"
+	config.InputImageResolution = 0
+	core, dir := "library", t.TempDir()
+	config.Tenants = []Tenant{{Name: "library", SolrCore: &core, XmlFileLocation: &dir}}
+	_, err := validateConfig(config)
+	problems, ok := err.(configErrors)
+	if !ok {
+		t.Fatalf("expected configuration errors, got %v", err)
+	}
+	for _, expected := range []string{"http_port", "log_level", "input_image_resolution", "dspace_host",
+		"solr_url", "index_type", "tenant library: invalid index_type"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected problem with %s in %v", expected, problems)
+		}
+	}
+
+	config = validConfig(t)
+	config.IndexType = process.FullIndex
+	if _, err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "escape_utf8") {
+		t.Errorf("expected escape_utf8 conflict with full indexing, got %v", err)
+	}
+	config = validConfig(t)
+	config.Tenants = []Tenant{{Name: "library", SolrCore: &core}}
+	if _, err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "xml_file_location") {
+		t.Errorf("expected tenant sharing the xml_file_location to be rejected, got %v", err)
+	}
+	config.Tenants = []Tenant{{Name: "library", XmlFileLocation: &dir}}
+	if _, err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "Solr core") {
+		t.Errorf("expected tenant sharing the Solr core to be rejected, got %v", err)
+	}
+	config = validConfig(t)
+	config.XmlFileLocation = config.XmlFileLocation + "/missing"
+	if _, err := validateConfig(config); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expected missing xml_file_location, got %v", err)
+	}
+}
+
+func TestTenantCredentials(t *testing.T) {
+	config := validConfig(t)
+	config.DSpaceUser, config.DSpacePassword = "admin", "dspace-secret"
+	config.SolrUsername, config.SolrPassword = "solr", "solr-secret"
+	host, solrUrl, core := "https://library.example.edu/server", "http://library-solr:8983/solr", "library"
+	tenant := Tenant{Name: "library-1", DSpaceHost: &host, SolrUrl: &solrUrl, SolrCore: &core}
+	envKey := envPrefix + "_TENANTS_LIBRARY_1_SOLR_PASSWORD"
+	if err := os.Setenv(envKey, "tenant-secret"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(envKey)
+	if err := configTenantSecrets(&tenant); err != nil {
+		t.Fatal(err)
+	}
+	settings := tenant.Apply(*config)
+	if settings.DSpaceUser != "" || settings.DSpacePassword != "" || settings.SolrUsername != "" {
+		t.Errorf("expected credentials of other hosts to be cleared: %+v", settings)
+	}
+	if settings.SolrPassword != "tenant-secret" {
+		t.Errorf("expected tenant Solr password from the environment, got %q", settings.SolrPassword)
+	}
+
+	core = "other"
+	settings = Tenant{Name: "other", SolrCore: &core}.Apply(*config)
+	if settings.DSpacePassword != "dspace-secret" || settings.SolrPassword != "solr-secret" {
+		t.Errorf("expected credentials of the same hosts to be inherited: %+v", settings)
+	}
+}
+
+func TestConfigList(t *testing.T) {
+	envKey := envPrefix + "_TENANTS"
+	if err := os.Setenv(envKey, `[{"name": "library", "solr_core": "library", "escape_utf8": false,
+		"collections": ["1234"]}]`); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv(envKey)
+	var tenants []Tenant
+	if err := configList("tenants", &tenants); err != nil {
+		t.Fatal(err)
+	}
+	if len(tenants) != 1 || tenants[0].Name != "library" || tenants[0].SolrCore == nil ||
+		*tenants[0].SolrCore != "library" || tenants[0].EscapeUtf8 == nil || *tenants[0].EscapeUtf8 ||
+		len(tenants[0].Collections) != 1 {
+		t.Errorf("unexpected tenants from the environment: %+v", tenants)
+	}
+
+	if err := os.Setenv(envKey, "library"); err != nil {
+		t.Fatal(err)
+	}
+	if err := configList("tenants", &tenants); err == nil {
+		t.Errorf("expected an error for a value that is not a JSON array")
+	}
+}
+
+func TestRunCheckConfig(t *testing.T) {
+	for _, key := range []string{"_SOLR_PASSWORD_FILE", "_S3_SECRET_KEY_FILE"} {
+		if err := os.Setenv(envPrefix+key, "/nonexistent/secret"); err != nil {
+			t.Fatal(err)
+		}
+		defer os.Unsetenv(envPrefix + key)
+	}
+	_, err := configSecrets("solr_password", "s3_secret_key")
+	if problems, ok := err.(configErrors); !ok || len(problems) != 2 {
+		t.Fatalf("expected a problem for each secret file, got %v", err)
+	}
+	if code := runCheckConfig(validConfig(t), err); code != 1 {
+		t.Errorf("expected unreadable secrets to fail the check, got exit code %d", code)
+	}
+	if code := runCheckConfig(nil, configErrors{"fatal error reading config file"}); code != 1 {
+		t.Errorf("expected an unreadable config file to fail the check, got exit code %d", code)
+	}
+	if code := runCheckConfig(validConfig(t), nil); code != 0 {
+		t.Errorf("expected a valid configuration to pass the check, got exit code %d", code)
+	}
+}